@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sourcegraph/conc/panics"
 	"github.com/vgarvardt/gue/v5"
 	"github.com/vgarvardt/gue/v5/adapter/pgxv5"
@@ -16,17 +19,28 @@ import (
 	tonutils "github.com/xssnick/tonutils-go/ton"
 	"go.uber.org/zap"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+
 	"github.com/eqtlab/ton-syncer/config"
 	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/pkg/health"
 	"github.com/eqtlab/ton-syncer/pkg/logger"
 	"github.com/eqtlab/ton-syncer/pkg/postgres"
+	"github.com/eqtlab/ton-syncer/pkg/secrets"
 	"github.com/eqtlab/ton-syncer/pkg/ton"
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
 	storage "github.com/eqtlab/ton-syncer/storage/postgres"
 	"github.com/eqtlab/ton-syncer/syncer"
 )
 
+const (
+	healthCheckTimeout = 5 * time.Second
+	shutdownGrace      = 5 * time.Second
+)
+
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	log := logger.New(true)
 
 	cfg, err := config.ParseEnv(ctx)
@@ -36,6 +50,16 @@ func main() {
 
 	log = logger.New(cfg.Debug)
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatal("can't setup tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("tracing shutdown", zap.Error(err))
+		}
+	}()
+
 	pool, err := postgres.Connect(ctx, cfg.DB)
 	if err != nil {
 		log.Fatal("can't connect to db", zap.Error(err))
@@ -45,6 +69,130 @@ func main() {
 	database := db.NewDB(pool, log)
 	store := storage.New(database)
 
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve":
+		serve(ctx, log, cfg, pool, database, store)
+	case "recategorize":
+		recategorize(ctx, log, os.Args[2:], store)
+	case "reconcile":
+		reconcile(ctx, log, os.Args[2:], cfg, pool, store)
+	case "verify":
+		verify(ctx, log, os.Args[2:], cfg, pool, store)
+	case "reprocess":
+		reprocess(ctx, log, os.Args[2:], cfg, store)
+	default:
+		log.Fatal(
+			"unknown command, expected serve, recategorize, reconcile, verify or reprocess",
+			zap.String("command", command),
+		)
+	}
+}
+
+// serve runs syncer as a service until ctx is done.
+func serve(
+	ctx context.Context,
+	log *logger.Logger,
+	cfg config.Config,
+	pool *pgxpool.Pool,
+	database *db.DB,
+	store *storage.Storage,
+) {
+	api, confirmers := connectTon(ctx, log, cfg.Syncer)
+	q := newQueue(log, pool)
+
+	tonSyncer, err := syncer.New(
+		syncer.WithStorage(store),
+		syncer.WithQueue(q),
+		syncer.WithTonAPI(api),
+		syncer.WithConfirmers(confirmers...),
+		syncer.WithSecrets(loadSecrets(log, cfg.Secrets)),
+		syncer.WithLogger(log.Logger),
+		syncer.WithConfig(cfg.Syncer),
+	)
+	if err != nil {
+		log.Fatal("can't create syncer", zap.Error(err))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health.Handler(healthCheckTimeout, map[string]health.Check{
+		"progress": tonSyncer.CheckLiveness,
+	}))
+	mux.Handle("/readyz", health.Handler(healthCheckTimeout, map[string]health.Check{
+		"db":         database.Ping,
+		"liteserver": tonSyncer.CheckLiteserver,
+		"queue":      tonSyncer.CheckQueue,
+	}))
+	server := &http.Server{Addr: cfg.HTTPAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	if err := tonSyncer.Start(ctx); err != nil {
+		log.Fatal("can't start syncer", zap.Error(err))
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var pc panics.Catcher
+		pc.Try(func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		})
+		if err := pc.Recovered().AsError(); err != nil {
+			serverErr <- err
+		}
+	}()
+
+	// give updaters their shutdown timeout and a bit more to return
+	shutdown := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), cfg.Syncer.ShutdownTimeout+shutdownGrace)
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Info("shutting down")
+	case err := <-tonSyncer.Done():
+		shutdownCtx, cancel := shutdown()
+		defer cancel()
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Error("http server shutdown", zap.Error(shutdownErr))
+		}
+		log.Fatal("syncer has failed", zap.Error(err))
+	case err := <-serverErr:
+		shutdownCtx, cancel := shutdown()
+		defer cancel()
+		if stopErr := tonSyncer.Stop(shutdownCtx); stopErr != nil {
+			log.Error("syncer stop", zap.Error(stopErr))
+		}
+		log.Fatal("http server has failed", zap.Error(err))
+	}
+
+	shutdownCtx, cancel := shutdown()
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("http server shutdown", zap.Error(err))
+	}
+
+	if err := tonSyncer.Stop(shutdownCtx); err != nil {
+		log.Error("syncer stop", zap.Error(err))
+		os.Exit(1)
+	}
+	log.Info("syncer has been stopped")
+}
+
+// connectTon connects to an archive liteserver from the global config and, when consensus is enabled,
+// to twice as many other archive liteservers confirming its responses. With VerifyProofs masterchain blocks
+// are validated starting from the trusted init block of the global config.
+func connectTon(
+	ctx context.Context,
+	log *logger.Logger,
+	cfg syncer.Config,
+) (api tonutils.APIClientWrapped, confirmers []tonutils.APIClientWrapped) {
 	tonCfg, err := liteclient.GetConfigFromUrl(ctx, "https://ton-blockchain.github.io/global.config.json")
 	if err != nil {
 		log.Fatal("liteclient get config from url", zap.Error(err))
@@ -55,44 +203,68 @@ func main() {
 		log.Fatal("archive node not found")
 	}
 
-	tonPool := liteclient.NewConnectionPool()
-	err = tonPool.AddConnection(ctx, ip, key)
+	api, err = newTonAPI(ctx, tonCfg, ton.Node{Addr: ip, Key: key}, cfg.VerifyProofs)
 	if err != nil {
 		log.Fatal("liteclient new connection pool", zap.Error(err))
 	}
 
-	poolAdapter := pgxv5.NewConnPool(pool)
-	q, err := gue.NewClient(poolAdapter, gue.WithClientLogger(adapter.New(log.Logger)))
-	if err != nil {
-		log.Fatal("pgx adapter for gue", zap.Error(err))
+	if cfg.ConsensusNodes == 0 {
+		return api, nil
 	}
 
-	api := tonutils.NewAPIClient(tonPool)
-	tonSyncer := syncer.New(store, q, api, tonPool, log.Logger, cfg.Syncer)
+	for _, node := range ton.FindArchiveNodes(ctx, tonCfg, 2*cfg.ConsensusNodes, ip) {
+		confirmer, err := newTonAPI(ctx, tonCfg, node, cfg.VerifyProofs)
+		if err != nil {
+			log.Warn("can't connect confirming liteserver", zap.Error(err), zap.String("node", node.Addr))
+			continue
+		}
+		confirmers = append(confirmers, confirmer)
+	}
+	if len(confirmers) < cfg.ConsensusNodes {
+		log.Fatal("not enough archive nodes for consensus", zap.Int("found", len(confirmers)))
+	}
 
-	runForever(
-		log,
-		func() { tonSyncer.Sync(ctx) },
-	)
+	return api, confirmers
+}
 
-	exit := make(chan os.Signal, 1)
-	signal.Notify(exit, os.Interrupt, syscall.SIGTERM)
-	<-exit
-	log.Info("bot has been stopped")
+func newTonAPI(
+	ctx context.Context,
+	tonCfg *liteclient.GlobalConfig,
+	node ton.Node,
+	verifyProofs bool,
+) (tonutils.APIClientWrapped, error) {
+	tonPool := liteclient.NewConnectionPool()
+	if err := tonPool.AddConnection(ctx, node.Addr, node.Key); err != nil {
+		return nil, err
+	}
+
+	client := ton.NewInstrumentedClient(tonPool, node.Addr)
+	if !verifyProofs {
+		return tonutils.NewAPIClient(client), nil
+	}
+
+	api := tonutils.NewAPIClient(client, tonutils.ProofCheckPolicySecure)
+	api.SetTrustedBlockFromConfig(tonCfg)
+	return api, nil
 }
 
-// runForever spawns goroutine for every f in ff. Each f is logged and restarted if panic occurs. It's non-blocking.
-func runForever(log *logger.Logger, ff ...func()) {
-	for i := range ff {
-		f := ff[i]
-		go func() {
-			var pc panics.Catcher
-			pc.Try(f)
-			if err := pc.Recovered().AsError(); err != nil {
-				log.Error("panic", zap.Error(err))
-				time.Sleep(time.Minute)
-				runForever(log, f)
-			}
-		}()
+// loadSecrets returns provider of private keys or nil if keys file is not configured.
+func loadSecrets(log *logger.Logger, cfg secrets.Config) syncer.SecretsProvider {
+	provider, err := secrets.Load(cfg)
+	if err != nil {
+		log.Fatal("can't load secrets", zap.Error(err))
+	}
+	if provider == nil {
+		return nil // not a typed nil, syncer checks for nil provider
+	}
+	return provider
+}
+
+func newQueue(log *logger.Logger, pool *pgxpool.Pool) *gue.Client {
+	poolAdapter := pgxv5.NewConnPool(pool)
+	q, err := gue.NewClient(poolAdapter, gue.WithClientLogger(adapter.New(log.Logger)))
+	if err != nil {
+		log.Fatal("pgx adapter for gue", zap.Error(err))
 	}
+	return q
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/pkg/logger"
+	storage "github.com/eqtlab/ton-syncer/storage/postgres"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+// recategorize re-applies categorization rules to already stored transactions.
+func recategorize(ctx context.Context, log *logger.Logger, args []string, store *storage.Storage) {
+	flags := flag.NewFlagSet("recategorize", flag.ExitOnError)
+	accountID := flags.Int("account", 0, "account id to recategorize, all crypto accounts if 0")
+	_ = flags.Parse(args)
+
+	tonSyncer, err := syncer.New(syncer.WithStorage(store), syncer.WithLogger(log.Logger))
+	if err != nil {
+		log.Fatal("can't create syncer", zap.Error(err))
+	}
+
+	updated, err := tonSyncer.Recategorize(ctx, *accountID)
+	if err != nil {
+		log.Fatal("recategorize", zap.Error(err), zap.Int("updated", updated))
+	}
+
+	log.Info("recategorize: done", zap.Int("updated", updated))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/config"
+	"github.com/eqtlab/ton-syncer/pkg/logger"
+	storage "github.com/eqtlab/ton-syncer/storage/postgres"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+// reconcile compares stored balances with on-chain ones and reports discrepancies.
+func reconcile(
+	ctx context.Context,
+	log *logger.Logger,
+	args []string,
+	cfg config.Config,
+	pool *pgxpool.Pool,
+	store *storage.Storage,
+) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	accountID := flags.Int("account", 0, "account id to reconcile, all crypto accounts if 0")
+	resync := flags.Bool("resync", false, "enqueue full history resync of accounts having discrepancies")
+	_ = flags.Parse(args)
+
+	cfg.Syncer.ConsensusNodes = 0 // balances are not confirmed
+	api, _ := connectTon(ctx, log, cfg.Syncer)
+
+	tonSyncer, err := syncer.New(
+		syncer.WithStorage(store),
+		syncer.WithQueue(newQueue(log, pool)),
+		syncer.WithTonAPI(api),
+		syncer.WithLogger(log.Logger),
+		syncer.WithConfig(cfg.Syncer),
+	)
+	if err != nil {
+		log.Fatal("can't create syncer", zap.Error(err))
+	}
+
+	found, err := tonSyncer.Reconcile(ctx, *accountID, *resync)
+	if err != nil {
+		log.Fatal("reconcile", zap.Error(err), zap.Int("discrepancies", len(found)))
+	}
+
+	for _, d := range found {
+		log.Info(
+			"reconcile: discrepancy",
+			zap.Int("account_id", d.AccountID),
+			zap.Int("asset_id", d.AssetID),
+			zap.Stringp("jetton", d.Jetton),
+			zap.String("stored", d.Stored.String()),
+			zap.String("on_chain", d.OnChain.String()),
+			zap.String("difference", d.OnChain.Sub(d.Stored).String()),
+			zap.Bool("resynced", d.Resynced),
+		)
+	}
+	log.Info("reconcile: done", zap.Int("discrepancies", len(found)))
+}
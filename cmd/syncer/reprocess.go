@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/config"
+	"github.com/eqtlab/ton-syncer/pkg/logger"
+	storage "github.com/eqtlab/ton-syncer/storage/postgres"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+// reprocess re-derives stored transactions from raw ones with the current parser.
+func reprocess(ctx context.Context, log *logger.Logger, args []string, cfg config.Config, store *storage.Storage) {
+	flags := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	accountID := flags.Int("account", 0, "account id to reprocess, all crypto accounts if 0")
+	sinceStr := flags.String("since", "", "reprocess transactions made at or after this date (2006-01-02 or RFC 3339), all if empty")
+	_ = flags.Parse(args)
+
+	var since time.Time
+	if *sinceStr != "" {
+		var err error
+		if since, err = parseSince(*sinceStr); err != nil {
+			log.Fatal("can't parse -since", zap.Error(err))
+		}
+	}
+
+	tonSyncer, err := syncer.New(
+		syncer.WithStorage(store),
+		syncer.WithSecrets(loadSecrets(log, cfg.Secrets)),
+		syncer.WithLogger(log.Logger),
+		syncer.WithConfig(cfg.Syncer),
+	)
+	if err != nil {
+		log.Fatal("can't create syncer", zap.Error(err))
+	}
+
+	res, err := tonSyncer.Reprocess(ctx, *accountID, since)
+	if err != nil {
+		log.Fatal("reprocess", zap.Error(err), zap.Int("created", res.Created), zap.Int("updated", res.Updated), zap.Int("deleted", res.Deleted))
+	}
+
+	log.Info("reprocess: done", zap.Int("created", res.Created), zap.Int("updated", res.Updated), zap.Int("deleted", res.Deleted))
+}
+
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/config"
+	"github.com/eqtlab/ton-syncer/pkg/logger"
+	storage "github.com/eqtlab/ton-syncer/storage/postgres"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+// verify looks for gaps in stored history and optionally enqueues jobs to fill them.
+func verify(
+	ctx context.Context,
+	log *logger.Logger,
+	args []string,
+	cfg config.Config,
+	pool *pgxpool.Pool,
+	store *storage.Storage,
+) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	accountID := flags.Int("account", 0, "account id to verify, all crypto accounts if 0")
+	repair := flags.Bool("repair", false, "enqueue updater jobs filling found gaps")
+	_ = flags.Parse(args)
+
+	tonSyncer, err := syncer.New(
+		syncer.WithStorage(store),
+		syncer.WithQueue(newQueue(log, pool)),
+		syncer.WithLogger(log.Logger),
+		syncer.WithConfig(cfg.Syncer),
+	)
+	if err != nil {
+		log.Fatal("can't create syncer", zap.Error(err))
+	}
+
+	gaps, err := tonSyncer.VerifyChains(ctx, *accountID, *repair)
+	if err != nil {
+		log.Fatal("verify", zap.Error(err), zap.Int("gaps", len(gaps)))
+	}
+
+	log.Info("verify: done", zap.Int("gaps", len(gaps)), zap.Bool("repair", *repair))
+}
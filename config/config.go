@@ -6,13 +6,18 @@ import (
 	"github.com/sethvargo/go-envconfig"
 
 	"github.com/eqtlab/ton-syncer/pkg/postgres"
+	"github.com/eqtlab/ton-syncer/pkg/secrets"
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
 	"github.com/eqtlab/ton-syncer/syncer"
 )
 
 type Config struct {
-	Debug  bool            `env:"APP_DEBUG"`
-	DB     postgres.Config `env:",prefix=DB_"`
-	Syncer syncer.Config   `env:",prefix=SYNCER_"`
+	Debug    bool            `env:"APP_DEBUG"`
+	HTTPAddr string          `env:"APP_HTTP_ADDR, default=:9090"` // Address to serve /metrics, /healthz and /readyz on
+	DB       postgres.Config `env:",prefix=DB_"`
+	Syncer   syncer.Config   `env:",prefix=SYNCER_"`
+	Tracing  tracing.Config  `env:",prefix=TRACING_"`
+	Secrets  secrets.Config  `env:",prefix=SECRETS_"`
 }
 
 func ParseEnv(ctx context.Context) (Config, error) {
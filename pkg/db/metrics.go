@@ -0,0 +1,49 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "ton_syncer",
+	Subsystem: "db",
+	Name:      "query_duration_seconds",
+	Help:      "Duration of database queries by statement.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"statement"})
+
+// statementLabel reduces sql to its verb and target table (e.g. "insert transactions")
+// so the label has low cardinality no matter how many values a query carries.
+func statementLabel(sql string) string {
+	fields := strings.Fields(strings.ToLower(sql))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	verb := fields[0]
+	var keyword string
+	switch verb {
+	case "select", "delete":
+		keyword = "from"
+	case "insert":
+		keyword = "into"
+	case "update":
+		if len(fields) > 1 {
+			return verb + " " + fields[1]
+		}
+		return verb
+	default:
+		return verb
+	}
+
+	for i := 1; i < len(fields)-1; i++ {
+		if fields[i] == keyword {
+			return verb + " " + strings.Trim(fields[i+1], "(;")
+		}
+	}
+
+	return verb
+}
@@ -9,11 +9,17 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/eqtlab/ton-syncer/pkg/logger"
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
 )
 
+var tracer = otel.Tracer("github.com/eqtlab/ton-syncer/pkg/db")
+
 type conn interface {
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
 }
@@ -84,10 +90,19 @@ func (db *DB) Delete(ctx context.Context, query squirrel.DeleteBuilder, handler
 	return nil
 }
 
-func (db *DB) query(ctx context.Context, sql string, args []any, scanner rowScanner) error {
+func (db *DB) query(ctx context.Context, sql string, args []any, scanner rowScanner) (err error) {
+	statement := statementLabel(sql)
+	ctx, span := tracer.Start(ctx, "db "+statement, trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", sql),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	start := time.Now()
 	defer func() {
-		go db.logQuery(time.Since(start), sql, args) // don't block flow
+		dur := time.Since(start)
+		queryDuration.WithLabelValues(statement).Observe(dur.Seconds())
+		go db.logQuery(dur, sql, args) // don't block flow
 	}()
 
 	rows, err := db.conn.Query(ctx, sql, args...)
@@ -159,3 +174,8 @@ func (db *DB) logQuery(dur time.Duration, sql string, args ...any) {
 		zap.Duration("dur", dur),
 	)
 }
+
+// Ping checks that database is reachable.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
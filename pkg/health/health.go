@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Check returns nil if the checked dependency is healthy.
+type Check func(ctx context.Context) error
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const statusOK = "ok"
+
+// Handler runs all checks with the given timeout and responds 200 if every check passed and 503 otherwise.
+// Body contains result of every check by its name.
+func Handler(timeout time.Duration, checks map[string]Check) http.Handler {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		resp := response{Status: statusOK, Checks: make(map[string]string, len(checks))}
+		for _, name := range names {
+			if err := checks[name](ctx); err != nil {
+				resp.Status = "fail"
+				resp.Checks[name] = err.Error()
+				continue
+			}
+			resp.Checks[name] = statusOK
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != statusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
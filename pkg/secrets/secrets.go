@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+var ErrInvalidKey = errors.New("invalid private key")
+
+type Config struct {
+	KeysFile string `env:"KEYS_FILE"` // JSON file with hex ed25519 seeds by account id, encrypted comments aren't decrypted if empty
+}
+
+// FileProvider keeps private keys of accounts loaded from a file.
+type FileProvider struct {
+	keys map[int]ed25519.PrivateKey
+}
+
+// Load returns provider with keys from the configured file, nil if there is no file configured.
+// Errors never contain key material.
+func Load(cfg Config) (*FileProvider, error) {
+	if cfg.KeysFile == "" {
+		return nil, nil
+	}
+
+	bb, err := os.ReadFile(cfg.KeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("read keys file: %w", err)
+	}
+
+	var seeds map[string]string
+	if err := json.Unmarshal(bb, &seeds); err != nil {
+		return nil, errors.New("parse keys file: not a JSON object of strings") // json errors may quote the content
+	}
+
+	keys := make(map[int]ed25519.PrivateKey, len(seeds))
+	for id, seed := range seeds {
+		accountID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("parse account id %q: %w", id, err)
+		}
+
+		raw, err := hex.DecodeString(seed)
+		if err != nil || len(raw) != ed25519.SeedSize {
+			return nil, fmt.Errorf("account %d: %w: expected %d hex bytes", accountID, ErrInvalidKey, ed25519.SeedSize)
+		}
+		keys[accountID] = ed25519.NewKeyFromSeed(raw)
+	}
+
+	return &FileProvider{keys: keys}, nil
+}
+
+// PrivateKey returns private key of the account or nil if there is none.
+func (p *FileProvider) PrivateKey(_ context.Context, accountID int) (ed25519.PrivateKey, error) {
+	return p.keys[accountID], nil
+}
+
+// String hides keys if provider ends up in a log.
+func (p *FileProvider) String() string {
+	return fmt.Sprintf("secrets.FileProvider{%d keys}", len(p.keys))
+}
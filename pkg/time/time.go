@@ -17,11 +17,29 @@ func TickWithCtx(ctx context.Context, interval time.Duration) <-chan time.Time {
 			case <-ctx.Done():
 				ticker.Stop()
 				close(ch)
+				return
 			case v := <-ticker.C:
-				ch <- v
+				select {
+				case ch <- v:
+				case <-ctx.Done(): // receiver may have already gone, next iteration closes ch
+				}
 			}
 		}
 	}()
 
 	return ch
 }
+
+// SleepWithCtx pauses current goroutine for at least d or until context cancelation.
+// It returns false if context was canceled before d elapsed.
+func SleepWithCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,77 @@
+package ton
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xssnick/tonutils-go/tl"
+	"github.com/xssnick/tonutils-go/ton"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
+)
+
+var tracer = otel.Tracer("github.com/eqtlab/ton-syncer/pkg/ton")
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ton_syncer",
+		Subsystem: "liteserver",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of liteserver requests by node and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"node", "method"})
+
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ton_syncer",
+		Subsystem: "liteserver",
+		Name:      "request_errors_total",
+		Help:      "Number of failed liteserver requests by node and method.",
+	}, []string{"node", "method"})
+)
+
+// InstrumentedClient is a ton.LiteClient that records latency, errors and a span for every liteserver request.
+type InstrumentedClient struct {
+	ton.LiteClient
+	node string
+}
+
+// NewInstrumentedClient wraps client, node is used as a metric label and usually is the liteserver address.
+func NewInstrumentedClient(client ton.LiteClient, node string) *InstrumentedClient {
+	return &InstrumentedClient{
+		LiteClient: client,
+		node:       node,
+	}
+}
+
+func (c *InstrumentedClient) QueryLiteserver(ctx context.Context, payload tl.Serializable, result tl.Serializable) error {
+	method := methodName(payload)
+	ctx, span := tracer.Start(ctx, "liteserver "+method, trace.WithAttributes(attribute.String("liteserver.node", c.node)))
+
+	start := time.Now()
+	err := c.LiteClient.QueryLiteserver(ctx, payload, result)
+	requestDuration.WithLabelValues(c.node, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(c.node, method).Inc()
+	}
+	tracing.End(span, err)
+
+	return err
+}
+
+// methodName returns request's type name, e.g. "GetTransactions".
+func methodName(payload tl.Serializable) string {
+	t := reflect.TypeOf(payload)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "unknown"
+	}
+	return t.Name()
+}
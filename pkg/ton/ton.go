@@ -9,11 +9,38 @@ import (
 	"github.com/xssnick/tonutils-go/ton"
 )
 
+// Node is a liteserver address and its public key.
+type Node struct {
+	Addr string
+	Key  string
+}
+
 func FindArchiveNode(ctx context.Context, cfg *liteclient.GlobalConfig) (ip, key string) {
+	nodes := FindArchiveNodes(ctx, cfg, 1)
+	if len(nodes) == 0 {
+		return "", ""
+	}
+	return nodes[0].Addr, nodes[0].Key
+}
+
+// FindArchiveNodes returns up to limit liteservers keeping full history, nodes with addresses from exclude are skipped.
+func FindArchiveNodes(ctx context.Context, cfg *liteclient.GlobalConfig, limit int, exclude ...string) []Node {
+	var nodes []Node
+
+next:
 	for _, liteSrv := range cfg.Liteservers {
-		client := liteclient.NewConnectionPool()
+		if len(nodes) == limit {
+			break
+		}
 
 		addr := fmt.Sprintf("%s:%d", intToIP4(liteSrv.IP), liteSrv.Port)
+		for _, e := range exclude {
+			if e == addr {
+				continue next
+			}
+		}
+
+		client := liteclient.NewConnectionPool()
 		if err := client.AddConnection(ctx, addr, liteSrv.ID.Key); err != nil {
 			continue
 		}
@@ -22,18 +49,20 @@ func FindArchiveNode(ctx context.Context, cfg *liteclient.GlobalConfig) (ip, key
 
 		master, err := api.GetMasterchainInfo(ctx)
 		if err != nil {
+			client.Stop()
 			continue
 		}
 
 		_, err = api.LookupBlock(ctx, master.Workchain, master.Shard, 3)
+		client.Stop()
 		if err != nil {
 			continue
 		}
 
-		return addr, liteSrv.ID.Key
+		nodes = append(nodes, Node{Addr: addr, Key: liteSrv.ID.Key})
 	}
 
-	return "", ""
+	return nodes
 }
 
 func intToIP4(ipInt int64) string {
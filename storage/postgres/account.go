@@ -33,7 +33,15 @@ func (s *Storage) GetAndLockAccountBySyncTime(
 			limit 1
 		) as unupdated_account
 		where accounts.id = unupdated_account.id
-		returning accounts.id, user_id, name, crypto_address, crypto_blockchain_id;
+		returning
+			accounts.id,
+			user_id,
+			name,
+			coalesce(main_asset_id, 0),
+			crypto_address,
+			crypto_blockchain_id,
+			parent_account_id,
+			crypto_jetton;
 `
 
 	account := &syncer.Account{}
@@ -43,8 +51,11 @@ func (s *Storage) GetAndLockAccountBySyncTime(
 			&account.ID,
 			&account.UserID,
 			&account.Name,
+			&account.MainAssetID,
 			&account.CryptoAddress,
 			&account.CryptoBlockchainID,
+			&account.ParentAccountID,
+			&account.CryptoJetton,
 		),
 		query,
 		newStart,
@@ -73,3 +84,75 @@ func (s *Storage) SetAccountEndSynсTime(ctx context.Context, accountID int, tim
 
 	return nil
 }
+
+func (s *Storage) GetCryptoAccounts(ctx context.Context) ([]*syncer.Account, error) {
+	query := sq.
+		Select(
+			"id",
+			"user_id",
+			"name",
+			"coalesce(main_asset_id, 0)",
+			"crypto_address",
+			"crypto_blockchain_id",
+			"parent_account_id",
+			"crypto_jetton",
+		).
+		From("accounts").
+		Where(sq.NotEq{"crypto_address": nil}).
+		OrderBy("id")
+
+	accounts := make([]*syncer.Account, 0)
+	err := s.db.Select(ctx, query, db.ScanAll(&accounts, func(a *syncer.Account) db.ScanArgs {
+		return db.ScanArgs{
+			&a.ID,
+			&a.UserID,
+			&a.Name,
+			&a.MainAssetID,
+			&a.CryptoAddress,
+			&a.CryptoBlockchainID,
+			&a.ParentAccountID,
+			&a.CryptoJetton,
+		}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func (s *Storage) CreateJettonWalletAccounts(ctx context.Context, accounts []syncer.Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("accounts").
+		Columns(
+			"user_id",
+			"name",
+			"main_asset_id",
+			"crypto_address",
+			"crypto_blockchain_id",
+			"parent_account_id",
+			"crypto_jetton",
+		).
+		Suffix("on conflict do nothing")
+
+	for _, a := range accounts {
+		query = query.Values(
+			a.UserID,
+			a.Name,
+			a.MainAssetID,
+			a.CryptoAddress,
+			a.CryptoBlockchainID,
+			a.ParentAccountID,
+			a.CryptoJetton,
+		)
+	}
+	if err := s.db.Insert(ctx, query, nil); err != nil {
+		return fmt.Errorf("insert jetton wallet accounts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// refreshBalances rebuilds running balances of accounts and assets of the given transactions. Balances of an account
+// are only written once its history is complete: storing its first transaction rebuilds all of them from the start,
+// later transactions rebuild them starting from the oldest of them. History is synced from newer to older, so pages
+// of a backfill don't rewrite balances of every newer transaction again and again.
+func refreshBalances(ctx context.Context, txDB *db.DB, txs []*syncer.Transaction) error {
+	type key struct{ accountID, assetID int }
+	fromLT := map[key]uint64{}
+	complete := map[int]bool{} // accounts whose first transaction is among the given ones
+	for _, tx := range txs {
+		if tx.CryptoTonLT == nil {
+			continue
+		}
+		if tx.CryptoPrevLT != nil && *tx.CryptoPrevLT == 0 {
+			complete[tx.AccountID] = true
+		}
+		k := key{tx.AccountID, tx.AssetID}
+		if lt, ok := fromLT[k]; !ok || *tx.CryptoTonLT < lt {
+			fromLT[k] = *tx.CryptoTonLT
+		}
+	}
+
+	// accounts are locked in the same order by every db transaction, so they can't deadlock
+	keys := make([]key, 0, len(fromLT))
+	for k := range fromLT {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accountID != keys[j].accountID {
+			return keys[i].accountID < keys[j].accountID
+		}
+		return keys[i].assetID < keys[j].assetID
+	})
+
+	rebuilt := map[int]bool{}
+	for _, k := range keys {
+		if complete[k.accountID] {
+			if rebuilt[k.accountID] {
+				continue
+			}
+			if err := rebuildBalances(ctx, txDB, k.accountID); err != nil {
+				return fmt.Errorf("rebuild balances of account %d: %w", k.accountID, err)
+			}
+			rebuilt[k.accountID] = true
+			continue
+		}
+
+		if err := refreshAssetBalances(ctx, txDB, k.accountID, k.assetID, fromLT[k]); err != nil {
+			return fmt.Errorf("refresh balances of account %d asset %d: %w", k.accountID, k.assetID, err)
+		}
+	}
+
+	return nil
+}
+
+// lockBalances serializes refreshes of the account's balances until the end of the db transaction,
+// otherwise concurrent jobs would sum transactions without the ones the other job hasn't committed yet.
+func lockBalances(ctx context.Context, txDB *db.DB, accountID int) error {
+	if err := txDB.RawQuery(ctx, nil, `select pg_advisory_xact_lock(hashtext('account_balances'), $1);`, accountID); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	return nil
+}
+
+// rebuildBalances writes balances of every asset of the account from its first transaction.
+func rebuildBalances(ctx context.Context, txDB *db.DB, accountID int) error {
+	if err := lockBalances(ctx, txDB, accountID); err != nil {
+		return err
+	}
+
+	// balances of transactions deleted since are dropped
+	stale := `
+		delete from account_balances b
+		where
+			b.account_id = $1 and
+			not exists(
+				select 1 from transactions t
+				where t.account_id = b.account_id and t.asset_id = b.asset_id and t.crypto_ton_lt = b.crypto_ton_lt
+			);
+	`
+	if err := txDB.RawQuery(ctx, nil, stale, accountID); err != nil {
+		return fmt.Errorf("db delete: %w", err)
+	}
+
+	query := `
+		insert into account_balances (account_id, asset_id, crypto_ton_lt, effective_at, balance)
+		select $1, asset_id, crypto_ton_lt, min(effective_at), sum(sum(amount)) over (partition by asset_id order by crypto_ton_lt)
+		from transactions
+		where account_id = $1 and crypto_ton_lt is not null
+		group by asset_id, crypto_ton_lt
+		on conflict (account_id, asset_id, crypto_ton_lt) do update
+		set balance = excluded.balance, effective_at = excluded.effective_at;
+	`
+
+	if err := txDB.RawQuery(ctx, nil, query, accountID); err != nil {
+		return fmt.Errorf("db insert: %w", err)
+	}
+	return nil
+}
+
+// refreshAssetBalances rebuilds balances of the account in the asset starting from the given logical time,
+// it does nothing until the account's balances were built from its first transaction.
+func refreshAssetBalances(ctx context.Context, txDB *db.DB, accountID, assetID int, fromLT uint64) error {
+	if err := lockBalances(ctx, txDB, accountID); err != nil {
+		return err
+	}
+
+	// balances of transactions deleted since are dropped
+	stale := `
+		delete from account_balances b
+		where
+			b.account_id = $1 and
+			b.asset_id = $2 and
+			b.crypto_ton_lt >= $3 and
+			not exists(
+				select 1 from transactions t
+				where t.account_id = b.account_id and t.asset_id = b.asset_id and t.crypto_ton_lt = b.crypto_ton_lt
+			);
+	`
+	if err := txDB.RawQuery(ctx, nil, stale, accountID, assetID, fromLT); err != nil {
+		return fmt.Errorf("db delete: %w", err)
+	}
+
+	query := `
+		with base as (
+			select coalesce((
+				select balance from account_balances
+				where account_id = $1 and asset_id = $2 and crypto_ton_lt < $3
+				order by crypto_ton_lt desc
+				limit 1
+			), 0) as balance
+		), deltas as (
+			select crypto_ton_lt, min(effective_at) as effective_at, sum(amount) as amount
+			from transactions
+			where account_id = $1 and asset_id = $2 and crypto_ton_lt >= $3
+			group by crypto_ton_lt
+		)
+		insert into account_balances (account_id, asset_id, crypto_ton_lt, effective_at, balance)
+		select $1, $2, crypto_ton_lt, effective_at, (select balance from base) + sum(amount) over (order by crypto_ton_lt)
+		from deltas
+		where exists(select 1 from account_balances where account_id = $1)
+		on conflict (account_id, asset_id, crypto_ton_lt) do update
+		set balance = excluded.balance, effective_at = excluded.effective_at;
+	`
+
+	if err := txDB.RawQuery(ctx, nil, query, accountID, assetID, fromLT); err != nil {
+		return fmt.Errorf("db insert: %w", err)
+	}
+	return nil
+}
+
+// GetBalanceAt returns balance of the account in the asset after its last transaction made at or before the given time.
+func (s *Storage) GetBalanceAt(ctx context.Context, accountID int, assetID int, at time.Time) (decimal.Decimal, error) {
+	query := `
+		select balance from account_balances
+		where account_id = $1 and asset_id = $2 and effective_at <= $3
+		order by crypto_ton_lt desc
+		limit 1;
+	`
+
+	var balance decimal.Decimal
+	err := s.db.RawQuery(ctx, db.ScanOnce(&balance), query, accountID, assetID, at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("db select: %w", err)
+	}
+
+	return balance, nil
+}
+
+// GetDailyBalances returns closing balances of the account in the asset for every day from `from` to `to` inclusive.
+// Days without transactions get the balance of the previous one.
+func (s *Storage) GetDailyBalances(
+	ctx context.Context,
+	accountID int,
+	assetID int,
+	from time.Time,
+	to time.Time,
+) ([]*syncer.DailyBalance, error) {
+	query := `
+		select day, coalesce((
+			select balance from account_balances
+			where account_id = $1 and asset_id = $2 and effective_at < day + interval '1 day'
+			order by crypto_ton_lt desc
+			limit 1
+		), 0)
+		from generate_series($3::date, $4::date, interval '1 day') as day
+		order by day;
+	`
+
+	balances := make([]*syncer.DailyBalance, 0)
+	err := s.db.RawQuery(ctx, db.ScanAll(&balances, func(b *syncer.DailyBalance) db.ScanArgs {
+		return db.ScanArgs{&b.Date, &b.Balance}
+	}), query, accountID, assetID, from, to)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return balances, nil
+}
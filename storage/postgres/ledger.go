@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+// CreateLedgerPostings inserts postings skipping already existing ones. External postings of an entry are deleted
+// when a posting of the same entry replaces them, i.e. the counterparty became tracked after the entry was posted.
+func (s *Storage) CreateLedgerPostings(ctx context.Context, postings []syncer.Posting) error {
+	if len(postings) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("ledger_postings").
+		Columns(
+			"entry_key",
+			"ledger_account",
+			"account_id",
+			"asset_id",
+			"amount",
+			"comment",
+			"crypto_hash",
+			"crypto_ton_lt",
+			"effective_at",
+		).
+		Suffix("on conflict do nothing")
+
+	var replaced sq.Or
+	for _, p := range postings {
+		query = query.Values(
+			p.EntryKey,
+			p.LedgerAccount,
+			p.AccountID,
+			p.AssetID,
+			p.Amount,
+			p.Comment,
+			p.CryptoHash,
+			p.CryptoTonLT,
+			p.EffectiveAt,
+		)
+		if p.Replaces != nil {
+			replaced = append(replaced, sq.Eq{"entry_key": p.EntryKey, "ledger_account": *p.Replaces})
+		}
+	}
+
+	err := s.db.RunInTransaction(ctx, func(ctx context.Context, txDB *db.DB) error {
+		if len(replaced) > 0 {
+			if err := txDB.Delete(ctx, sq.Delete("ledger_postings").Where(replaced), nil); err != nil {
+				return fmt.Errorf("delete replaced ledger postings: %w", err)
+			}
+		}
+
+		if err := txDB.Insert(ctx, query, nil); err != nil {
+			return fmt.Errorf("insert ledger postings: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("db transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) CreateNFTTransfers(ctx context.Context, transfers []syncer.NFTTransfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("nft_transfers").
+		Columns(
+			"account_id",
+			"item",
+			"collection",
+			"from_address",
+			"to_address",
+			"direction",
+			"bounced",
+			"crypto_hash",
+			"crypto_ton_lt",
+			"effective_at",
+		).
+		Suffix("on conflict do nothing")
+
+	for _, t := range transfers {
+		query = query.Values(
+			t.AccountID,
+			t.Item,
+			t.Collection,
+			t.From,
+			t.To,
+			t.Direction,
+			t.Bounced,
+			t.CryptoHash,
+			t.CryptoTonLT,
+			t.EffectiveAt,
+		)
+	}
+	if err := s.db.Insert(ctx, query, nil); err != nil {
+		return fmt.Errorf("insert nft transfers: %w", err)
+	}
+
+	return nil
+}
+
+// GetAccountNFTs returns NFT items the account owns according to its synced transfers.
+func (s *Storage) GetAccountNFTs(ctx context.Context, accountID int) ([]*syncer.NFTOwnership, error) {
+	query := sq.
+		Select("account_id", "item", "collection", "acquired_lt", "acquired_at").
+		From("nft_ownership").
+		Where(sq.Eq{"account_id": accountID}).
+		OrderBy("acquired_lt desc")
+
+	items := make([]*syncer.NFTOwnership, 0)
+	err := s.db.Select(ctx, query, db.ScanAll(&items, func(o *syncer.NFTOwnership) db.ScanArgs {
+		return db.ScanArgs{&o.AccountID, &o.Item, &o.Collection, &o.AcquiredLT, &o.AcquiredAt}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+func (s *Storage) GetQueueStats(ctx context.Context, jobType string) (*syncer.QueueStats, error) {
+	query := `
+		select count(*), min(created_at) from gue_jobs
+		where job_type = $1;
+	`
+
+	stats := &syncer.QueueStats{}
+	if err := s.db.RawQuery(ctx, db.ScanOnce(&stats.Depth, &stats.OldestJobCreatedAt), query, jobType); err != nil {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (s *Storage) GetQueuedJobHashes(ctx context.Context, jobType string, accountID int) ([]string, error) {
+	query := `
+		select args->>'TxHash' from (
+			select convert_from(args, 'UTF8')::jsonb as args from gue_jobs
+			where job_type = $1
+		) j
+		where (args->>'accountId')::int = $2;
+	`
+
+	rows := make([]*string, 0)
+	err := s.db.RawQuery(ctx, db.ScanAll(&rows, func(h *string) db.ScanArgs {
+		return db.ScanArgs{h}
+	}), query, jobType, accountID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	hashes := make([]string, len(rows))
+	for i, h := range rows {
+		hashes[i] = *h
+	}
+	return hashes, nil
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) CreateRawTransactions(ctx context.Context, txs []syncer.RawTransaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("raw_transactions").
+		Columns(
+			"account_id",
+			"crypto_hash",
+			"crypto_ton_lt",
+			"boc",
+			"block_workchain",
+			"block_shard",
+			"block_seqno",
+			"block_root_hash",
+			"block_file_hash",
+		).
+		Suffix("on conflict do nothing")
+
+	for _, tx := range txs {
+		query = query.Values(
+			tx.AccountID,
+			tx.CryptoHash,
+			tx.CryptoTonLT,
+			tx.BOC,
+			tx.BlockWorkchain,
+			tx.BlockShard,
+			tx.BlockSeqno,
+			tx.BlockRootHash,
+			tx.BlockFileHash,
+		)
+	}
+	if err := s.db.Insert(ctx, query, nil); err != nil {
+		return fmt.Errorf("insert raw transactions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRawTransactions(
+	ctx context.Context,
+	accountID int,
+	afterLT uint64,
+	limit int,
+) ([]*syncer.RawTransaction, error) {
+	query := sq.
+		Select(
+			"account_id",
+			"crypto_hash",
+			"crypto_ton_lt",
+			"boc",
+			"block_workchain",
+			"block_shard",
+			"block_seqno",
+			"block_root_hash",
+			"block_file_hash",
+		).
+		From("raw_transactions").
+		Where(sq.Eq{"account_id": accountID}).
+		Where(sq.Gt{"crypto_ton_lt": afterLT}).
+		OrderBy("crypto_ton_lt").
+		Limit(uint64(limit))
+
+	txs := make([]*syncer.RawTransaction, 0, limit)
+	err := s.db.Select(ctx, query, db.ScanAll(&txs, func(tx *syncer.RawTransaction) db.ScanArgs {
+		return db.ScanArgs{
+			&tx.AccountID,
+			&tx.CryptoHash,
+			&tx.CryptoTonLT,
+			&tx.BOC,
+			&tx.BlockWorkchain,
+			&tx.BlockShard,
+			&tx.BlockSeqno,
+			&tx.BlockRootHash,
+			&tx.BlockFileHash,
+		}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return txs, nil
+}
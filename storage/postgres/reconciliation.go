@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetAccountLastTonLT(ctx context.Context, accountID int) (uint64, error) {
+	query := `select coalesce(max(crypto_ton_lt), 0) from transactions where account_id = $1;`
+
+	var lt uint64
+	if err := s.db.RawQuery(ctx, db.ScanOnce(&lt), query, accountID); err != nil {
+		return 0, fmt.Errorf("db select: %w", err)
+	}
+
+	return lt, nil
+}
+
+func (s *Storage) GetAccountBalances(ctx context.Context, accountID int) ([]*syncer.AssetBalance, error) {
+	query := sq.
+		Select("crypto_jetton", "sum(amount)").
+		From("transactions").
+		Where(sq.Eq{"account_id": accountID}).
+		Where(sq.NotEq{"crypto_hash": nil}).
+		GroupBy("crypto_jetton")
+
+	balances := make([]*syncer.AssetBalance, 0)
+	err := s.db.Select(ctx, query, db.ScanAll(&balances, func(b *syncer.AssetBalance) db.ScanArgs {
+		return db.ScanArgs{&b.Jetton, &b.Amount}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return balances, nil
+}
+
+func (s *Storage) CreateDiscrepancies(ctx context.Context, discrepancies []*syncer.Discrepancy) error {
+	if len(discrepancies) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("reconciliation_discrepancies").
+		Columns("account_id", "asset_id", "jetton", "stored", "on_chain", "resynced", "checked_at")
+
+	for _, d := range discrepancies {
+		query = query.Values(d.AccountID, d.AssetID, d.Jetton, d.Stored, d.OnChain, d.Resynced, d.CheckedAt)
+	}
+	if err := s.db.Insert(ctx, query, nil); err != nil {
+		return fmt.Errorf("insert discrepancies: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetCategorizationRules(ctx context.Context, accountID int) ([]*syncer.Rule, error) {
+	query := `
+		select
+			id, user_id, priority, merchant, comment_regexp, min_amount, max_amount,
+			direction, jetton, op_code, category_id, merchant_label
+		from categorization_rules
+		where user_id is null or user_id = (select user_id from accounts where accounts.id = $1)
+		order by priority desc, user_id nulls last, id;
+	`
+
+	rules := make([]*syncer.Rule, 0)
+	err := s.db.RawQuery(
+		ctx,
+		db.ScanAll(&rules, func(r *syncer.Rule) db.ScanArgs {
+			return db.ScanArgs{
+				&r.ID,
+				&r.UserID,
+				&r.Priority,
+				&r.Merchant,
+				&r.CommentRegexp,
+				&r.MinAmount,
+				&r.MaxAmount,
+				&r.Direction,
+				&r.Jetton,
+				&r.OpCode,
+				&r.CategoryID,
+				&r.MerchantLabel,
+			}
+		}),
+		query,
+		accountID,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return rules, nil
+}
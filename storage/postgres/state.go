@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eqtlab/ton-syncer/syncer"
+)
+
+func (s *Storage) CreateAccountState(ctx context.Context, state syncer.AccountState) error {
+	var iface *syncer.Interface
+	if state.Interface != "" {
+		iface = &state.Interface
+	}
+
+	// snapshot is skipped if the latest one of the account is the same
+	query := `
+		insert into account_states (account_id, status, interface, code_hash, balance, last_tx_lt, last_activity_at, checked_at)
+		select $1::int, $2::varchar, $3::varchar, $4::varchar, $5::decimal, $6::numeric, $7::timestamp, $8::timestamp
+		where not exists(
+			select 1 from (
+				select * from account_states
+				where account_id = $1
+				order by checked_at desc, id desc
+				limit 1
+			) l
+			where
+				l.status = $2 and
+				l.interface is not distinct from $3 and
+				l.code_hash is not distinct from $4 and
+				l.balance = $5 and
+				l.last_tx_lt = $6 and
+				l.last_activity_at is not distinct from $7
+		);
+	`
+
+	err := s.db.RawQuery(
+		ctx,
+		nil,
+		query,
+		state.AccountID,
+		state.Status,
+		iface,
+		state.CodeHash,
+		state.Balance,
+		state.LastTxLT,
+		state.LastActivityAt,
+		state.CheckedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert account state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/eqtlab/ton-syncer/pkg/db"
+	"github.com/eqtlab/ton-syncer/syncer"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) CreateSwapLegs(ctx context.Context, legs []syncer.SwapLeg) error {
+	if len(legs) == 0 {
+		return nil
+	}
+
+	query := sq.
+		Insert("swap_legs").
+		Columns(
+			"account_id",
+			"dex",
+			"side",
+			"query_id",
+			"asset_id",
+			"jetton",
+			"amount",
+			"pool",
+			"crypto_hash",
+			"crypto_ton_lt",
+			"effective_at",
+		).
+		Suffix("on conflict do nothing")
+
+	for _, l := range legs {
+		query = query.Values(
+			l.AccountID,
+			l.DEX,
+			l.Side,
+			l.QueryID,
+			l.AssetID,
+			l.Jetton,
+			l.Amount,
+			l.Pool,
+			l.CryptoHash,
+			l.CryptoTonLT,
+			l.EffectiveAt,
+		)
+	}
+	if err := s.db.Insert(ctx, query, nil); err != nil {
+		return fmt.Errorf("insert swap legs: %w", err)
+	}
+
+	return nil
+}
+
+// GetAccountSwaps returns swaps of the account whose requests are paid out, newer first.
+func (s *Storage) GetAccountSwaps(ctx context.Context, accountID int) ([]*syncer.Swap, error) {
+	query := sq.
+		Select(
+			"account_id",
+			"dex",
+			"pool",
+			"sold_asset_id",
+			"sold_jetton",
+			"sold_amount",
+			"bought_asset_id",
+			"bought_jetton",
+			"bought_amount",
+			"sell_hash",
+			"buy_hash",
+			"effective_at",
+		).
+		From("swaps").
+		Where(sq.Eq{"account_id": accountID}).
+		OrderBy("buy_lt desc")
+
+	swaps := make([]*syncer.Swap, 0)
+	err := s.db.Select(ctx, query, db.ScanAll(&swaps, func(sw *syncer.Swap) db.ScanArgs {
+		return db.ScanArgs{
+			&sw.AccountID,
+			&sw.DEX,
+			&sw.Pool,
+			&sw.SoldAssetID,
+			&sw.SoldJetton,
+			&sw.SoldAmount,
+			&sw.BoughtAssetID,
+			&sw.BoughtJetton,
+			&sw.BoughtAmount,
+			&sw.SellHash,
+			&sw.BuyHash,
+			&sw.EffectiveAt,
+		}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return swaps, nil
+}
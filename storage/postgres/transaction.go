@@ -12,6 +12,23 @@ import (
 )
 
 func (s *Storage) CreateTonTransactions(ctx context.Context, txs []syncer.Transaction) error {
+	err := s.db.RunInTransaction(ctx, func(ctx context.Context, txDB *db.DB) error {
+		inserted, err := insertTransactions(ctx, txDB, txs)
+		if err != nil {
+			return err
+		}
+		return refreshBalances(ctx, txDB, inserted)
+	})
+	if err != nil {
+		return fmt.Errorf("db transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertTransactions inserts transactions skipping already stored ones and returns
+// account, asset and logical times of the inserted ones.
+func insertTransactions(ctx context.Context, txDB *db.DB, txs []syncer.Transaction) ([]*syncer.Transaction, error) {
 	query := sq.
 		Insert("transactions").
 		Columns(
@@ -23,9 +40,24 @@ func (s *Storage) CreateTonTransactions(ctx context.Context, txs []syncer.Transa
 			"comment",
 			"crypto_hash",
 			"crypto_ton_lt",
+			"crypto_counterparty",
+			"crypto_op_code",
+			"crypto_jetton",
+			"crypto_entry",
+			"crypto_msg_hash",
+			"is_internal",
+			"crypto_prev_hash",
+			"crypto_prev_lt",
+			"block_workchain",
+			"block_shard",
+			"block_seqno",
+			"masterchain_seqno",
+			"status",
+			"crypto_kind",
+			"crypto_details",
 			"effective_at",
 		).
-		Suffix("on conflict do nothing")
+		Suffix("on conflict do nothing returning account_id, asset_id, crypto_ton_lt, crypto_prev_lt")
 
 	for _, tx := range txs {
 		query = query.Values(
@@ -37,14 +69,34 @@ func (s *Storage) CreateTonTransactions(ctx context.Context, txs []syncer.Transa
 			tx.Comment,
 			tx.CryptoHash,
 			tx.CryptoTonLT,
+			tx.CryptoCounterparty,
+			tx.CryptoOpCode,
+			tx.CryptoJetton,
+			tx.CryptoEntry,
+			tx.CryptoMsgHash,
+			tx.Internal,
+			tx.CryptoPrevHash,
+			tx.CryptoPrevLT,
+			tx.BlockWorkchain,
+			tx.BlockShard,
+			tx.BlockSeqno,
+			tx.MasterchainSeqno,
+			tx.Status,
+			nullableKind(tx.Kind),
+			tx.Details,
 			tx.EffectiveAt,
 		)
 	}
-	if err := s.db.Insert(ctx, query, nil); err != nil {
-		return fmt.Errorf("insert new transaction: %w", err)
+
+	inserted := make([]*syncer.Transaction, 0, len(txs))
+	err := txDB.Insert(ctx, query, db.ScanAll(&inserted, func(tx *syncer.Transaction) db.ScanArgs {
+		return db.ScanArgs{&tx.AccountID, &tx.AssetID, &tx.CryptoTonLT, &tx.CryptoPrevLT}
+	}))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("insert new transaction: %w", err)
 	}
 
-	return nil
+	return inserted, nil
 }
 
 func (s *Storage) IsExistingCryptoTransaction(ctx context.Context, accountID int, cryptoHash string) (bool, error) {
@@ -67,3 +119,303 @@ func (s *Storage) IsExistingCryptoTransaction(ctx context.Context, accountID int
 
 	return true, nil
 }
+
+func (s *Storage) GetAccountTransactions(
+	ctx context.Context,
+	accountID int,
+	afterID int,
+	limit int,
+) ([]*syncer.Transaction, error) {
+	query := sq.
+		Select(transactionColumns...).
+		From("transactions").
+		Where(sq.Eq{"account_id": accountID}).
+		Where(sq.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(uint64(limit))
+
+	txs := make([]*syncer.Transaction, 0, limit)
+	err := s.db.Select(ctx, query, db.ScanAll(&txs, scanTransaction))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return txs, nil
+}
+
+func (s *Storage) GetTransactionsByHashes(
+	ctx context.Context,
+	accountID int,
+	cryptoHashes []string,
+) ([]*syncer.Transaction, error) {
+	query := sq.
+		Select(transactionColumns...).
+		From("transactions").
+		Where(sq.Eq{"account_id": accountID}).
+		Where(sq.Eq{"crypto_hash": cryptoHashes}).
+		OrderBy("id")
+
+	txs := make([]*syncer.Transaction, 0, len(cryptoHashes))
+	err := s.db.Select(ctx, query, db.ScanAll(&txs, scanTransaction))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return txs, nil
+}
+
+// transactionColumns are selected columns scanTransaction expects.
+var transactionColumns = []string{
+	"id",
+	"account_id",
+	"asset_id",
+	"category_id",
+	"coalesce(merchant, '')",
+	"amount",
+	"coalesce(comment, '')",
+	"crypto_hash",
+	"crypto_ton_lt",
+	"crypto_counterparty",
+	"crypto_op_code",
+	"crypto_jetton",
+	"crypto_entry",
+	"crypto_msg_hash",
+	"is_internal",
+	"crypto_prev_hash",
+	"crypto_prev_lt",
+	"block_workchain",
+	"block_shard",
+	"block_seqno",
+	"masterchain_seqno",
+	"status",
+	"coalesce(crypto_kind, '')",
+	"crypto_details",
+	"effective_at",
+}
+
+func scanTransaction(tx *syncer.Transaction) db.ScanArgs {
+	return db.ScanArgs{
+		&tx.ID,
+		&tx.AccountID,
+		&tx.AssetID,
+		&tx.CategoryID,
+		&tx.Merchant,
+		&tx.Amount,
+		&tx.Comment,
+		&tx.CryptoHash,
+		&tx.CryptoTonLT,
+		&tx.CryptoCounterparty,
+		&tx.CryptoOpCode,
+		&tx.CryptoJetton,
+		&tx.CryptoEntry,
+		&tx.CryptoMsgHash,
+		&tx.Internal,
+		&tx.CryptoPrevHash,
+		&tx.CryptoPrevLT,
+		&tx.BlockWorkchain,
+		&tx.BlockShard,
+		&tx.BlockSeqno,
+		&tx.MasterchainSeqno,
+		&tx.Status,
+		&tx.Kind,
+		&tx.Details,
+		&tx.EffectiveAt,
+	}
+}
+
+func (s *Storage) UpdateTransactionsCategory(ctx context.Context, txs []syncer.Transaction) error {
+	err := s.db.RunInTransaction(ctx, func(ctx context.Context, txDB *db.DB) error {
+		for _, tx := range txs {
+			query := sq.
+				Update("transactions").
+				Set("category_id", tx.CategoryID).
+				Set("merchant", tx.Merchant).
+				Where(sq.Eq{"id": tx.ID})
+
+			if err := txDB.Update(ctx, query, nil); err != nil {
+				return fmt.Errorf("update transaction %d: %w", tx.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("db update: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) LinkInternalTransfers(ctx context.Context, msgHashes []string) error {
+	if len(msgHashes) == 0 {
+		return nil
+	}
+
+	query := `
+		update transactions set is_internal = true
+		where
+			not is_internal and
+			crypto_entry in ('value', 'jetton') and
+			crypto_msg_hash = any($1);
+	`
+
+	if err := s.db.RawQuery(ctx, nil, query, msgHashes); err != nil {
+		return fmt.Errorf("db update: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetChainGaps(ctx context.Context, accountID int) ([]*syncer.ChainGap, error) {
+	query := `
+		select t.account_id, t.crypto_prev_hash, t.crypto_prev_lt from transactions t
+		where
+			t.account_id = $1 and
+			t.crypto_prev_lt <> 0 and -- previous transaction is set on one row of each transaction
+			not exists(
+				select 1 from transactions p
+				where
+					p.account_id = t.account_id and
+					p.crypto_ton_lt = t.crypto_prev_lt
+			)
+		order by t.crypto_prev_lt desc;
+	`
+
+	gaps := make([]*syncer.ChainGap, 0)
+	err := s.db.RawQuery(ctx, db.ScanAll(&gaps, func(g *syncer.ChainGap) db.ScanArgs {
+		return db.ScanArgs{&g.AccountID, &g.TxHash, &g.TxLT}
+	}), query, accountID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return gaps, nil
+}
+
+func (s *Storage) ApplyTransactionCorrections(
+	ctx context.Context,
+	create []syncer.Transaction,
+	update []syncer.Transaction,
+	remove []syncer.Transaction,
+) error {
+	err := s.db.RunInTransaction(ctx, func(ctx context.Context, txDB *db.DB) error {
+		var changed []*syncer.Transaction
+		if len(create) > 0 {
+			inserted, err := insertTransactions(ctx, txDB, create)
+			if err != nil {
+				return err
+			}
+			changed = append(changed, inserted...)
+		}
+
+		for _, tx := range update {
+			query := sq.
+				Update("transactions").
+				Set("amount", tx.Amount).
+				Set("comment", tx.Comment).
+				Set("crypto_counterparty", tx.CryptoCounterparty).
+				Set("crypto_op_code", tx.CryptoOpCode).
+				Set("crypto_jetton", tx.CryptoJetton).
+				Set("crypto_msg_hash", tx.CryptoMsgHash).
+				Set("is_internal", tx.Internal).
+				Set("crypto_prev_hash", tx.CryptoPrevHash).
+				Set("crypto_prev_lt", tx.CryptoPrevLT).
+				Set("crypto_kind", nullableKind(tx.Kind)).
+				Set("crypto_details", tx.Details).
+				Set("effective_at", tx.EffectiveAt).
+				Where(sq.Eq{"id": tx.ID})
+
+			if err := txDB.Update(ctx, query, nil); err != nil {
+				return fmt.Errorf("update transaction %d: %w", tx.ID, err)
+			}
+		}
+
+		if len(remove) > 0 {
+			ids := make([]int, len(remove))
+			for i, tx := range remove {
+				ids[i] = tx.ID
+			}
+			if err := txDB.Delete(ctx, sq.Delete("transactions").Where(sq.Eq{"id": ids}), nil); err != nil {
+				return fmt.Errorf("delete transactions: %w", err)
+			}
+		}
+
+		for i := range update {
+			changed = append(changed, &update[i])
+		}
+		for i := range remove {
+			changed = append(changed, &remove[i])
+		}
+		return refreshBalances(ctx, txDB, changed)
+	})
+	if err != nil {
+		return fmt.Errorf("db transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ConfirmTransactions(ctx context.Context, maxMasterchainSeqno uint32) (int, error) {
+	query := `
+		update transactions set status = 'confirmed'
+		where status = 'pending' and masterchain_seqno <= $1
+		returning id;
+	`
+
+	var confirmed int
+	err := s.db.RawQuery(ctx, func(rows pgx.Rows) error {
+		confirmed++
+		return nil
+	}, query, maxMasterchainSeqno)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("db update: %w", err)
+	}
+
+	return confirmed, nil
+}
+
+func (s *Storage) GetUnanchoredTransactions(ctx context.Context, afterID int, limit int) ([]*syncer.Transaction, error) {
+	query := sq.
+		Select(transactionColumns...).
+		From("transactions").
+		Where(sq.Eq{"status": syncer.TxStatusPending, "masterchain_seqno": nil}).
+		Where(sq.NotEq{"block_seqno": nil}).
+		Where(sq.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(uint64(limit))
+
+	txs := make([]*syncer.Transaction, 0, limit)
+	err := s.db.Select(ctx, query, db.ScanAll(&txs, scanTransaction))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db select: %w", err)
+	}
+
+	return txs, nil
+}
+
+func (s *Storage) SetTransactionsMasterchainSeqno(ctx context.Context, txs []syncer.Transaction) error {
+	err := s.db.RunInTransaction(ctx, func(ctx context.Context, txDB *db.DB) error {
+		for _, tx := range txs {
+			query := sq.
+				Update("transactions").
+				Set("masterchain_seqno", tx.MasterchainSeqno).
+				Where(sq.Eq{"id": tx.ID})
+
+			if err := txDB.Update(ctx, query, nil); err != nil {
+				return fmt.Errorf("update transaction %d: %w", tx.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("db update: %w", err)
+	}
+
+	return nil
+}
+
+func nullableKind(kind syncer.Kind) *syncer.Kind {
+	if kind == "" {
+		return nil
+	}
+	return &kind
+}
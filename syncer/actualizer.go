@@ -4,31 +4,44 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/xssnick/tonutils-go/address"
 	"github.com/xssnick/tonutils-go/tlb"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
 )
 
 // actualizer finds account that must be synced, sets the lock for it by setting its start time equal to now
 // and checks if the last transaction from blockchain already exists in storage.
 // If its not there it enqueues a task for updater queue. Actualizer never fail.
-func (s *Syncer) actualizer(ctx context.Context) {
-	time.Sleep(s.cfg.ActualizerStartDelay)
+func (s *Syncer) actualizer(ctx context.Context, id int) {
+	label := strconv.Itoa(id)
+	if !timeutils.SleepWithCtx(ctx, s.cfg.ActualizerStartDelay) {
+		return
+	}
 	for range timeutils.TickWithCtx(ctx, s.cfg.AccountsCheckInterval) {
 		err := s.iteration(ctx)
+		s.progress.actualizer.Store(time.Now().UnixNano()) // failed iterations are progress too, the worker isn't stuck
 		if err != nil {
+			actualizerIterations.WithLabelValues(label, outcomeError).Inc()
 			s.logger.Error("actualizer worker failed", zap.Error(err)) // if one fail we continue
+			continue
 		}
+		actualizerIterations.WithLabelValues(label, "ok").Inc()
 	}
 }
 
 var ErrAccountWithoutAddr = errors.New("account found but has not crypto address")
 
-func (s *Syncer) iteration(ctx context.Context) error {
+func (s *Syncer) iteration(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "actualizer.iteration")
+	defer func() { tracing.End(span, err) }()
+
 	start, end := getSyncTime(time.Now(), s.cfg.UpdaterLock, s.cfg.AccountSyncInterval)
 
 	account, err := s.storage.GetAndLockAccountBySyncTime(ctx, time.Now(), start, end)
@@ -41,12 +54,32 @@ func (s *Syncer) iteration(ctx context.Context) error {
 		return nil
 	}
 
+	span.SetAttributes(attribute.Int("account.id", account.ID))
+
 	if account.CryptoAddress == nil {
 		return fmt.Errorf("%w: %v", ErrAccountWithoutAddr, account)
 	}
 
+	if s.cfg.JettonWallets && account.ParentAccountID == nil {
+		assets := make([]*jettonAsset, 0, len(s.jettonAssets))
+		for _, asset := range s.jettonAssets {
+			assets = append(assets, asset)
+		}
+		// wallets are only an addition to the owner's history, so failing to find them doesn't stop its sync
+		if err := s.discoverJettonWallets(ctx, account, assets); err != nil {
+			s.logger.Warn("actualizer: failed to discover jetton wallets", zap.Error(err), zap.Int("account_id", account.ID))
+		}
+	}
+
 	tonAccount, err := s.getTonAccount(*account.CryptoAddress, ctx)
+	if s.cfg.AccountStates && (err == nil || errors.Is(err, errTonAccNotInitialized)) {
+		// snapshots are only an addition to the history, so failing to store one doesn't stop the sync
+		if stateErr := s.recordAccountState(ctx, account, tonAccount); stateErr != nil {
+			s.logger.Warn("actualizer: failed to record account state", zap.Error(stateErr), zap.Int("account_id", account.ID))
+		}
+	}
 	if errors.Is(err, errTonAccNotInitialized) {
+		actualizerAccounts.WithLabelValues(outcomeNotInitialized).Inc()
 		s.logger.Debug(
 			"actualizer: ton account found but it's not initialized",
 			zap.String("ton_address", *account.CryptoAddress),
@@ -64,6 +97,7 @@ func (s *Syncer) iteration(ctx context.Context) error {
 		return fmt.Errorf("is existing crypto transaction: %w", err)
 	}
 	if ok {
+		actualizerAccounts.WithLabelValues(outcomeUpToDate).Inc()
 		s.logger.Debug(
 			"actualizer: account is already up to date",
 			zap.Int("account_id", account.ID),
@@ -79,22 +113,36 @@ func (s *Syncer) iteration(ctx context.Context) error {
 		return nil
 	}
 
-	if err := s.enqueue(
-		ctx,
-		tonAccount.State.Address,
-		account.ID,
-		tonAccount.LastTxHash,
-		tonAccount.LastTxLT,
-	); err != nil {
+	if s.cfg.ConsensusNodes > 0 {
+		lastTx := [][]byte{tonAccount.LastTxHash}
+		if err := s.confirm(ctx, tonAccount.State.Address, tonAccount.LastTxLT, tonAccount.LastTxHash, lastTx); err != nil {
+			return fmt.Errorf("confirm last transaction: %w", err)
+		}
+	}
+
+	assetID := account.MainAssetID
+	if assetID == 0 {
+		assetID = s.cfg.AssetID
+	}
+
+	if err := s.enqueue(ctx, jobArgs{
+		Addr:      tonAccount.State.Address.String(),
+		AccountID: account.ID,
+		AssetID:   assetID,
+		TxHash:    tonAccount.LastTxHash,
+		TxLT:      tonAccount.LastTxLT,
+		Jetton:    account.CryptoJetton,
+	}); err != nil {
 		return fmt.Errorf("enqueue: %w", err)
 	}
+	actualizerAccounts.WithLabelValues(outcomeEnqueued).Inc()
 
 	return nil
 }
 
 var errTonAccNotInitialized = errors.New("ton account not initialized")
 
-// getTonAccount returns errTonAccNotInitialized if account is found but not initialized.
+// getTonAccount returns errTonAccNotInitialized if account is found but not initialized, the account is returned too.
 func (s *Syncer) getTonAccount(strAddr string, ctx context.Context) (*tlb.Account, error) {
 	addr, err := address.ParseAddr(strAddr)
 	if err != nil {
@@ -112,7 +160,7 @@ func (s *Syncer) getTonAccount(strAddr string, ctx context.Context) (*tlb.Accoun
 	}
 
 	if tonAcc == nil || tonAcc.State == nil {
-		return nil, errTonAccNotInitialized
+		return tonAcc, errTonAccNotInitialized
 	}
 
 	return tonAcc, nil
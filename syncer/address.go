@@ -0,0 +1,55 @@
+package syncer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xssnick/tonutils-go/address"
+)
+
+// rawAddr returns address in raw form "workchain:hex". Unlike user-friendly form it doesn't depend
+// on bounce and testnet flags, so it's used whenever addresses are compared.
+func rawAddr(addr *address.Address) string {
+	return strconv.Itoa(int(addr.Workchain())) + ":" + hex.EncodeToString(addr.Data())
+}
+
+// parseAnyAddr parses address in either user-friendly or raw form.
+func parseAnyAddr(s string) (*address.Address, error) {
+	wc, data, ok := strings.Cut(s, ":")
+	if !ok {
+		return address.ParseAddr(s)
+	}
+
+	workchain, err := strconv.ParseInt(wc, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parse workchain: %w", err)
+	}
+
+	bb, err := hex.DecodeString(data)
+	if err != nil || len(bb) != 32 {
+		return nil, fmt.Errorf("invalid raw address %q", s)
+	}
+
+	return address.NewAddress(0, byte(workchain), bb), nil
+}
+
+// sameAddr reports whether a and b are the same address written in any form.
+// Strings that are not addresses are compared as is.
+func sameAddr(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	addrA, err := parseAnyAddr(a)
+	if err != nil {
+		return false
+	}
+	addrB, err := parseAnyAddr(b)
+	if err != nil {
+		return false
+	}
+
+	return rawAddr(addrA) == rawAddr(addrB)
+}
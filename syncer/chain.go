@@ -0,0 +1,137 @@
+package syncer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+)
+
+// chainVerifier periodically verifies and repairs history of all accounts until ctx is done.
+func (s *Syncer) chainVerifier(ctx context.Context) {
+	for range timeutils.TickWithCtx(ctx, s.cfg.ChainVerifyInterval) {
+		if _, err := s.VerifyChains(ctx, 0, true); err != nil {
+			s.logger.Error("chain verifier: failed", zap.Error(err))
+		}
+	}
+}
+
+// VerifyChains checks that stored transactions of the account, or of every crypto account if accountID is 0,
+// form an unbroken chain: the previous transaction of every stored one is stored too.
+// If repair is true, an updater job is enqueued for every gap, it fetches history backwards from the missing
+// transaction and stops at the first already stored one. Gaps some queued job already fetches from are not enqueued
+// again, and while the account has queued jobs the oldest gap is left to its backfill which hasn't reached it yet.
+// Transactions stored without previous hash are not checked.
+func (s *Syncer) VerifyChains(ctx context.Context, accountID int, repair bool) ([]*ChainGap, error) {
+	if repair && s.q == nil {
+		return nil, fmt.Errorf("%w: queue", ErrMissingDependency)
+	}
+
+	accounts, err := s.storage.GetCryptoAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage get crypto accounts: %w", err)
+	}
+
+	var found []*ChainGap
+	for _, account := range accounts {
+		if accountID != 0 && account.ID != accountID {
+			continue
+		}
+
+		gaps, err := s.verifyAccountChain(ctx, account, repair)
+		if err != nil {
+			return found, fmt.Errorf("verify account %d: %w", account.ID, err)
+		}
+		found = append(found, gaps...)
+
+		if accountID != 0 {
+			return found, nil
+		}
+	}
+
+	if accountID != 0 {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+	}
+
+	return found, nil
+}
+
+func (s *Syncer) verifyAccountChain(ctx context.Context, account *Account, repair bool) ([]*ChainGap, error) {
+	gaps, err := s.storage.GetChainGaps(ctx, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("storage get chain gaps: %w", err)
+	}
+	chainGapsFound.Add(float64(len(gaps)))
+
+	for _, gap := range gaps {
+		s.logger.Warn(
+			"chain verifier: stored history has a gap",
+			zap.Int("account_id", gap.AccountID),
+			zap.String("missing_hash", gap.TxHash),
+			zap.Uint64("missing_lt", gap.TxLT),
+		)
+	}
+
+	if !repair || len(gaps) == 0 {
+		return gaps, nil
+	}
+
+	queued, err := s.storage.GetQueuedJobHashes(ctx, queueType, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("storage get queued job hashes: %w", err)
+	}
+
+	addr, err := parseAnyAddr(*account.CryptoAddress)
+	if err != nil {
+		return nil, fmt.Errorf("parse addr: %w", err)
+	}
+
+	assetID := account.MainAssetID
+	if assetID == 0 {
+		assetID = s.cfg.AssetID
+	}
+
+	for _, gap := range gapsToRepair(gaps, queued) {
+		hash, err := base64.StdEncoding.DecodeString(gap.TxHash)
+		if err != nil {
+			return nil, fmt.Errorf("decode hash %q: %w", gap.TxHash, err)
+		}
+
+		if err := s.enqueue(ctx, jobArgs{
+			Addr:      addr.String(),
+			AccountID: account.ID,
+			AssetID:   assetID,
+			TxHash:    hash,
+			TxLT:      gap.TxLT,
+			Jetton:    account.CryptoJetton,
+		}); err != nil {
+			return nil, fmt.Errorf("enqueue: %w", err)
+		}
+	}
+
+	return gaps, nil
+}
+
+// gapsToRepair returns gaps no queued job fetches from. Gaps are ordered from newer to older, while the account
+// has queued jobs the oldest one is the frontier of its backfill, which hasn't reached it yet.
+func gapsToRepair(gaps []*ChainGap, queued []string) []*ChainGap {
+	pending := make(map[string]bool, len(queued))
+	for _, hash := range queued {
+		pending[hash] = true
+	}
+
+	if len(queued) > 0 && len(gaps) > 0 {
+		gaps = gaps[:len(gaps)-1]
+	}
+
+	out := make([]*ChainGap, 0, len(gaps))
+	for _, gap := range gaps {
+		if !pending[gap.TxHash] {
+			out = append(out, gap)
+		}
+	}
+	return out
+}
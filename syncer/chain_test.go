@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// chainStorage serves stored accounts and gaps of their chains, other Storage methods are not used by VerifyChains.
+type chainStorage struct {
+	Storage
+	accounts []*Account
+	gaps     map[int][]*ChainGap
+}
+
+func (c *chainStorage) GetCryptoAccounts(context.Context) ([]*Account, error) {
+	return c.accounts, nil
+}
+
+func (c *chainStorage) GetChainGaps(_ context.Context, accountID int) ([]*ChainGap, error) {
+	return c.gaps[accountID], nil
+}
+
+func TestVerifyChains(t *testing.T) {
+	broken := []*ChainGap{
+		{AccountID: 1, TxHash: "newer", TxLT: 30},
+		{AccountID: 1, TxHash: "older", TxLT: 10},
+	}
+	s := &Syncer{
+		logger: zap.NewNop(),
+		storage: &chainStorage{
+			accounts: []*Account{{ID: 1}, {ID: 2}},
+			gaps:     map[int][]*ChainGap{1: broken},
+		},
+	}
+
+	found, err := s.VerifyChains(context.Background(), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, broken) {
+		t.Fatalf("gaps of all accounts = %v, want %v", found, broken)
+	}
+
+	found, err = s.VerifyChains(context.Background(), 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("unbroken chain has gaps %v", found)
+	}
+
+	if _, err = s.VerifyChains(context.Background(), 3, false); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("unknown account error = %v, want %v", err, ErrAccountNotFound)
+	}
+
+	if _, err = s.VerifyChains(context.Background(), 1, true); !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("repair without queue error = %v, want %v", err, ErrMissingDependency)
+	}
+}
+
+func TestGapsToRepair(t *testing.T) {
+	gaps := []*ChainGap{{TxHash: "newest"}, {TxHash: "middle"}, {TxHash: "oldest"}}
+
+	tests := []struct {
+		name   string
+		queued []string
+		want   []string
+	}{
+		{name: "nothing queued", want: []string{"newest", "middle", "oldest"}},
+		{name: "backfill frontier left", queued: []string{"other"}, want: []string{"newest", "middle"}},
+		{name: "already queued", queued: []string{"middle"}, want: []string{"newest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, gap := range gapsToRepair(gaps, tt.queued) {
+				got = append(got, gap.TxHash)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("gaps to repair = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := gapsToRepair(nil, []string{"other"}); len(got) != 0 {
+		t.Fatalf("gaps to repair without gaps = %v", got)
+	}
+}
@@ -0,0 +1,95 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"go.uber.org/zap"
+)
+
+// ErrNoConsensus is returned when not enough liteservers confirm a response.
+var ErrNoConsensus = errors.New("liteservers don't agree")
+
+// confirm asks confirming liteservers, starting from the next one in turn, for transactions up to
+// the given one and succeeds once ConsensusNodes of them return transactions with the expected hashes.
+// Nodes which fail or disagree are logged and the next ones are asked instead.
+func (s *Syncer) confirm(ctx context.Context, addr *address.Address, lt uint64, hash []byte, expected [][]byte) error {
+	need := s.cfg.ConsensusNodes
+	if need == 0 {
+		return nil
+	}
+
+	start := int(s.nextConfirmer.Add(1))
+	var agreed int
+	for i := range s.confirmers {
+		confirmer := s.confirmers[(start+i)%len(s.confirmers)]
+
+		txs, err := confirmer.ListTransactions(ctx, addr, uint32(len(expected)), lt, hash)
+		if err != nil {
+			consensusResponses.WithLabelValues(outcomeError).Inc()
+			s.logger.Warn("consensus: liteserver failed to confirm", zap.Error(err), zap.Stringer("address", addr))
+			continue
+		}
+
+		if !sameTxHashes(txs, expected) {
+			consensusResponses.WithLabelValues(outcomeDisagreed).Inc()
+			s.logger.Warn(
+				"consensus: liteserver disagrees",
+				zap.Stringer("address", addr),
+				zap.Uint64("lt", lt),
+				zap.String("hash", txHashToString(hash)),
+			)
+			continue
+		}
+
+		consensusResponses.WithLabelValues(outcomeAgreed).Inc()
+		if agreed++; agreed == need {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %d of %d liteservers confirmed", ErrNoConsensus, agreed, need)
+}
+
+// needsConsensus tells whether rows have an absolute value or jetton amount at least ConsensusMinAmount,
+// so large withdrawals are confirmed as well as large deposits.
+// All rows need it if ConsensusMinAmount is zero.
+func (s *Syncer) needsConsensus(txs []Transaction) bool {
+	if s.cfg.ConsensusNodes == 0 {
+		return false
+	}
+	if s.cfg.ConsensusMinAmount.IsZero() {
+		return true
+	}
+
+	for _, tx := range txs {
+		if (tx.CryptoEntry == EntryValue || tx.CryptoEntry == EntryJetton) && tx.Amount.Abs().GreaterThanOrEqual(s.cfg.ConsensusMinAmount) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameTxHashes(txs []*tlb.Transaction, expected [][]byte) bool {
+	if len(txs) != len(expected) {
+		return false
+	}
+	for i := range txs {
+		if !bytes.Equal(txs[i].Hash, expected[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func txHashes(txs []*tlb.Transaction) [][]byte {
+	out := make([][]byte, len(txs))
+	for i, tx := range txs {
+		out[i] = tx.Hash
+	}
+	return out
+}
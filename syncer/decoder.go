@@ -0,0 +1,278 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/ton/nft"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+const (
+	opComment              = 0x00000000
+	opExcesses             = 0xd53276db
+	opNFTTransfer          = 0x5fcc3d14
+	opNFTOwnershipAssigned = 0x05138d91
+)
+
+// Kind tells what the message a transaction row comes from means.
+type Kind string
+
+const (
+	KindTransfer                   Kind = "transfer"          // plain transfer without body
+	KindComment                    Kind = "comment"           // transfer with text comment
+	KindEncryptedComment           Kind = "encrypted_comment" // transfer with comment encrypted for the receiver, decrypted into Comment if key is known
+	KindUnknown                    Kind = "unknown"           // body with an op code no decoder is registered for or malformed body
+	KindJettonTransfer             Kind = "jetton_transfer"
+	KindJettonTransferNotification Kind = "jetton_transfer_notification"
+	KindJettonInternalTransfer     Kind = "jetton_internal_transfer"
+	KindJettonBurn                 Kind = "jetton_burn"
+	KindExcesses                   Kind = "excesses"
+	KindNFTTransfer                Kind = "nft_transfer"
+	KindNFTOwnershipAssigned       Kind = "nft_ownership_assigned"
+)
+
+// Decoder decodes message bodies starting with some op code into their kind and details.
+// Details are stored as JSON so they should marshal to an object.
+type Decoder interface {
+	Decode(body *cell.Cell) (Kind, any, error)
+}
+
+// DecoderFunc is an adapter to use ordinary functions as decoders.
+type DecoderFunc func(body *cell.Cell) (Kind, any, error)
+
+func (f DecoderFunc) Decode(body *cell.Cell) (Kind, any, error) {
+	return f(body)
+}
+
+// Decoders are decoders by op code.
+type Decoders map[uint32]Decoder
+
+// defaultDecoders returns decoders of well-known op codes.
+func defaultDecoders() Decoders {
+	return Decoders{
+		opComment:                    DecoderFunc(decodeComment),
+		opEncryptedComment:           DecoderFunc(decodeEncryptedComment),
+		opJettonTransfer:             DecoderFunc(decodeJettonTransfer),
+		opJettonTransferNotification: DecoderFunc(decodeJettonTransferNotification),
+		opJettonInternalTransfer:     DecoderFunc(decodeJettonInternalTransfer),
+		opJettonBurn:                 DecoderFunc(decodeJettonBurn),
+		opExcesses:                   DecoderFunc(decodeExcesses),
+		opNFTTransfer:                DecoderFunc(decodeNFTTransfer),
+		opNFTOwnershipAssigned:       DecoderFunc(decodeNFTOwnershipAssigned),
+	}
+}
+
+// decode returns kind of the body and its details as JSON, nil if there are none.
+func (d Decoders) decode(body *cell.Cell) (Kind, json.RawMessage) {
+	op := opCode(body)
+	if op == nil {
+		return KindTransfer, nil
+	}
+
+	decoder, ok := d[*op]
+	if !ok {
+		return KindUnknown, nil
+	}
+
+	kind, details, err := decoder.Decode(body)
+	if err != nil {
+		return KindUnknown, nil // malformed body is just not what its op code claims
+	}
+	if details == nil {
+		return kind, nil
+	}
+
+	bb, err := json.Marshal(details)
+	if err != nil {
+		return kind, nil
+	}
+	return kind, bb
+}
+
+type commentDetails struct {
+	Text string `json:"text"`
+}
+
+type jettonTransferDetails struct {
+	QueryID             uint64  `json:"queryId"`
+	Amount              string  `json:"amount"` // in jetton's minimal units
+	Destination         string  `json:"destination"`
+	ResponseDestination *string `json:"responseDestination,omitempty"`
+	ForwardTONAmount    string  `json:"forwardTonAmount"`
+	Comment             string  `json:"comment,omitempty"`
+}
+
+type jettonTransferNotificationDetails struct {
+	QueryID uint64 `json:"queryId"`
+	Amount  string `json:"amount"` // in jetton's minimal units
+	Sender  string `json:"sender"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type jettonInternalTransferDetails struct {
+	QueryID          uint64  `json:"queryId"`
+	Amount           string  `json:"amount"` // in jetton's minimal units
+	From             *string `json:"from,omitempty"`
+	ForwardTONAmount string  `json:"forwardTonAmount"`
+	Comment          string  `json:"comment,omitempty"`
+}
+
+type jettonBurnDetails struct {
+	QueryID             uint64  `json:"queryId"`
+	Amount              string  `json:"amount"` // in jetton's minimal units
+	ResponseDestination *string `json:"responseDestination,omitempty"`
+}
+
+type excesses struct {
+	_       tlb.Magic `tlb:"#d53276db"`
+	QueryID uint64    `tlb:"## 64"`
+}
+
+type queryDetails struct {
+	QueryID uint64 `json:"queryId"`
+}
+
+type nftOwnershipAssigned struct {
+	_              tlb.Magic        `tlb:"#05138d91"`
+	QueryID        uint64           `tlb:"## 64"`
+	PrevOwner      *address.Address `tlb:"addr"`
+	ForwardPayload *cell.Cell       `tlb:"either . ^"`
+}
+
+type nftTransferDetails struct {
+	QueryID             uint64  `json:"queryId"`
+	NewOwner            string  `json:"newOwner"`
+	ResponseDestination *string `json:"responseDestination,omitempty"`
+	ForwardAmount       string  `json:"forwardAmount"`
+}
+
+type nftOwnershipAssignedDetails struct {
+	QueryID   uint64 `json:"queryId"`
+	PrevOwner string `json:"prevOwner"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+func decodeComment(body *cell.Cell) (Kind, any, error) {
+	slice := body.BeginParse()
+	if _, err := slice.LoadUInt(32); err != nil {
+		return "", nil, err
+	}
+
+	text, err := slice.LoadStringSnake()
+	if err != nil {
+		return "", nil, fmt.Errorf("load text: %w", err)
+	}
+	return KindComment, commentDetails{Text: text}, nil
+}
+
+// decodeEncryptedComment only tells the kind, text is decrypted while casting if the key is known
+// and kept out of details to not duplicate it.
+func decodeEncryptedComment(body *cell.Cell) (Kind, any, error) {
+	return KindEncryptedComment, nil, nil
+}
+
+func decodeJettonTransfer(body *cell.Cell) (Kind, any, error) {
+	var t jetton.TransferPayload
+	if err := tlb.LoadFromCell(&t, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindJettonTransfer, jettonTransferDetails{
+		QueryID:             t.QueryID,
+		Amount:              t.Amount.Nano().String(),
+		Destination:         t.Destination.String(),
+		ResponseDestination: addrString(t.ResponseDestination),
+		ForwardTONAmount:    t.ForwardTONAmount.String(),
+		Comment:             payloadComment(t.ForwardPayload),
+	}, nil
+}
+
+func decodeJettonTransferNotification(body *cell.Cell) (Kind, any, error) {
+	var n jettonTransferNotification
+	if err := tlb.LoadFromCell(&n, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindJettonTransferNotification, jettonTransferNotificationDetails{
+		QueryID: n.QueryID,
+		Amount:  n.Amount.Nano().String(),
+		Sender:  n.Sender.String(),
+		Comment: payloadComment(n.ForwardPayload),
+	}, nil
+}
+
+func decodeJettonInternalTransfer(body *cell.Cell) (Kind, any, error) {
+	var t jettonInternalTransfer
+	if err := tlb.LoadFromCell(&t, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindJettonInternalTransfer, jettonInternalTransferDetails{
+		QueryID:          t.QueryID,
+		Amount:           t.Amount.Nano().String(),
+		From:             addrString(t.From),
+		ForwardTONAmount: t.ForwardTONAmount.String(),
+		Comment:          payloadComment(t.ForwardPayload),
+	}, nil
+}
+
+func decodeJettonBurn(body *cell.Cell) (Kind, any, error) {
+	var b jetton.BurnPayload
+	if err := tlb.LoadFromCell(&b, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindJettonBurn, jettonBurnDetails{
+		QueryID:             b.QueryID,
+		Amount:              b.Amount.Nano().String(),
+		ResponseDestination: addrString(b.ResponseDestination),
+	}, nil
+}
+
+func decodeExcesses(body *cell.Cell) (Kind, any, error) {
+	var e excesses
+	if err := tlb.LoadFromCell(&e, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+	return KindExcesses, queryDetails{QueryID: e.QueryID}, nil
+}
+
+func decodeNFTTransfer(body *cell.Cell) (Kind, any, error) {
+	var t nft.TransferPayload
+	if err := tlb.LoadFromCell(&t, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindNFTTransfer, nftTransferDetails{
+		QueryID:             t.QueryID,
+		NewOwner:            t.NewOwner.String(),
+		ResponseDestination: addrString(t.ResponseDestination),
+		ForwardAmount:       t.ForwardAmount.String(),
+	}, nil
+}
+
+func decodeNFTOwnershipAssigned(body *cell.Cell) (Kind, any, error) {
+	var a nftOwnershipAssigned
+	if err := tlb.LoadFromCell(&a, body.BeginParse()); err != nil {
+		return "", nil, err
+	}
+
+	return KindNFTOwnershipAssigned, nftOwnershipAssignedDetails{
+		QueryID:   a.QueryID,
+		PrevOwner: a.PrevOwner.String(),
+		Comment:   payloadComment(a.ForwardPayload),
+	}, nil
+}
+
+// addrString returns address as string or nil for none address.
+func addrString(addr *address.Address) *string {
+	if addr == nil || addr.Type() == address.NoneAddress {
+		return nil
+	}
+	s := addr.String()
+	return &s
+}
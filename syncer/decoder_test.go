@@ -0,0 +1,86 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+func TestDecodersDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    *cell.Cell
+		kind    Kind
+		details string
+	}{
+		{name: "no body", kind: KindTransfer},
+		{name: "short body", body: cell.BeginCell().MustStoreUInt(1, 8).EndCell(), kind: KindTransfer},
+		{
+			name:    "comment",
+			body:    cell.BeginCell().MustStoreUInt(opComment, 32).MustStoreStringSnake("hello").EndCell(),
+			kind:    KindComment,
+			details: `{"text":"hello"}`,
+		},
+		{
+			name:    "excesses",
+			body:    cell.BeginCell().MustStoreUInt(opExcesses, 32).MustStoreUInt(7, 64).EndCell(),
+			kind:    KindExcesses,
+			details: `{"queryId":7}`,
+		},
+		{
+			name: "encrypted comment",
+			body: cell.BeginCell().MustStoreUInt(opEncryptedComment, 32).EndCell(),
+			kind: KindEncryptedComment,
+		},
+		{
+			name: "unknown op code",
+			body: cell.BeginCell().MustStoreUInt(0xdeadbeef, 32).MustStoreUInt(7, 64).EndCell(),
+			kind: KindUnknown,
+		},
+		{
+			name: "malformed excesses",
+			body: cell.BeginCell().MustStoreUInt(opExcesses, 32).MustStoreUInt(7, 16).EndCell(),
+			kind: KindUnknown,
+		},
+		{
+			name: "malformed jetton transfer",
+			body: cell.BeginCell().MustStoreUInt(opJettonTransfer, 32).MustStoreUInt(7, 64).EndCell(),
+			kind: KindUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, details := defaultDecoders().decode(tt.body)
+			if kind != tt.kind {
+				t.Fatalf("kind = %q, want %q", kind, tt.kind)
+			}
+			if string(details) != tt.details {
+				t.Fatalf("details = %s, want %s", details, tt.details)
+			}
+		})
+	}
+}
+
+func TestWithDecoder(t *testing.T) {
+	const opCustom = 0x12345678
+	custom := DecoderFunc(func(body *cell.Cell) (Kind, any, error) {
+		return "custom", queryDetails{QueryID: 1}, nil
+	})
+
+	s, err := New(WithStorage(&chainStorage{}), WithDecoder(opExcesses, custom), WithDecoder(opCustom, custom))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []uint32{opExcesses, opCustom} {
+		kind, details := s.decoders.decode(cell.BeginCell().MustStoreUInt(uint64(op), 32).EndCell())
+		if kind != "custom" || string(details) != `{"queryId":1}` {
+			t.Fatalf("op %#x decoded to %q %s, want registered decoder", op, kind, details)
+		}
+	}
+
+	kind, _ := s.decoders.decode(cell.BeginCell().MustStoreUInt(opComment, 32).MustStoreStringSnake("hi").EndCell())
+	if kind != KindComment {
+		t.Fatalf("built-in decoder not kept: kind = %q", kind)
+	}
+}
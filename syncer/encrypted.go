@@ -0,0 +1,66 @@
+package syncer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/ton/wallet"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+const opEncryptedComment = wallet.EncryptedCommentOpcode
+
+// SecretsProvider supplies private keys of tracked wallets. Keys are only used to decrypt comments,
+// they are never stored or logged, so errors returned by the provider must not contain them either.
+type SecretsProvider interface {
+	// PrivateKey returns private key of the account's wallet or nil if there is none.
+	PrivateKey(ctx context.Context, accountID int) (ed25519.PrivateKey, error)
+}
+
+// privateKey returns private key of the account or nil if it's unknown or there is no secrets provider.
+func (s *Syncer) privateKey(ctx context.Context, accountID int) (ed25519.PrivateKey, error) {
+	if s.secrets == nil {
+		return nil, nil
+	}
+
+	key, err := s.secrets.PrivateKey(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("account %d: %w", accountID, err)
+	}
+	if key != nil && len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("account %d: private key has wrong size", accountID)
+	}
+	return key, nil
+}
+
+// decryptComment returns text of the encrypted comment, ok is false if there is no key or body
+// was not encrypted with it. The key may be of either side: body keeps xor of both public keys,
+// so the other side's public key is restored from ours.
+func decryptComment(body *cell.Cell, sender *address.Address, key ed25519.PrivateKey) (text string, ok bool) {
+	if key == nil || body == nil || sender == nil {
+		return "", false
+	}
+
+	slice := body.BeginParse()
+	if _, err := slice.LoadUInt(32); err != nil {
+		return "", false
+	}
+	xored, err := slice.LoadSlice(256)
+	if err != nil {
+		return "", false
+	}
+
+	ours := key.Public().(ed25519.PublicKey)
+	theirs := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	for i := range theirs {
+		theirs[i] = xored[i] ^ ours[i]
+	}
+
+	plain, err := wallet.DecryptCommentCell(body, sender, key, theirs)
+	if err != nil {
+		return "", false // message key check fails if the key is of neither side
+	}
+	return string(plain), true
+}
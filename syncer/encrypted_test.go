@@ -0,0 +1,46 @@
+package syncer
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+func TestDecryptComment(t *testing.T) {
+	sender := address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+	senderKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	receiverKey := ed25519.NewKeyFromSeed([]byte("receiver seed of thirty two byte"))
+	otherKey := ed25519.NewKeyFromSeed([]byte("some other seed of 32 bytes long"))
+
+	body, err := wallet.CreateEncryptedCommentCell("secret", sender, senderKey, receiverKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  ed25519.PrivateKey
+		text string
+		ok   bool
+	}{
+		{name: "sender key", key: senderKey, text: "secret", ok: true},
+		{name: "receiver key", key: receiverKey, text: "secret", ok: true},
+		{name: "key of neither side", key: otherKey},
+		{name: "no key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, ok := decryptComment(body, sender, tt.key)
+			if text != tt.text || ok != tt.ok {
+				t.Fatalf("decrypted %q, %v, want %q, %v", text, ok, tt.text, tt.ok)
+			}
+		})
+	}
+
+	other := address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+	if _, ok := decryptComment(body, other, receiverKey); ok {
+		t.Fatal("decrypted with wrong sender address")
+	}
+}
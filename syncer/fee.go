@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"math/big"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/tlb"
+)
+
+const tonDecimals = 9
+
+// fees is a breakdown of what transaction has cost the account.
+type fees struct {
+	storage, compute, action, forward *big.Int // nanotons
+}
+
+// parseFees splits transaction's total fees by phases, forward is the sum of forward fees of outgoing messages.
+// Whatever total fees are not explained by storage and action phases is attributed to compute phase,
+// so the parts always sum up to the total.
+func parseFees(tx *tlb.Transaction, forward *big.Int) fees {
+	f := fees{
+		storage: new(big.Int),
+		compute: new(big.Int).Set(tx.TotalFees.Coins.Nano()),
+		action:  new(big.Int),
+		forward: forward,
+	}
+
+	switch d := tx.Description.Description.(type) {
+	case tlb.TransactionDescriptionOrdinary:
+		if d.StoragePhase != nil {
+			f.storage.Set(d.StoragePhase.StorageFeesCollected.Nano())
+		}
+		if d.ActionPhase != nil && d.ActionPhase.TotalActionFees != nil {
+			f.action.Set(d.ActionPhase.TotalActionFees.Nano())
+		}
+	case tlb.TransactionDescriptionStorage:
+		f.storage.Set(d.StoragePhase.StorageFeesCollected.Nano())
+	}
+
+	f.compute.Sub(f.compute, f.storage)
+	f.compute.Sub(f.compute, f.action)
+
+	return f
+}
+
+// feeEntries is the order fee rows are emitted in.
+var feeEntries = []Entry{EntryFeeStorage, EntryFeeCompute, EntryFeeAction, EntryFeeForward}
+
+var feeComments = map[Entry]string{
+	EntryFeeStorage: "storage fee",
+	EntryFeeCompute: "compute fee",
+	EntryFeeAction:  "action fee",
+	EntryFeeForward: "forward fee",
+}
+
+// byEntry returns non-zero fees by their entry type.
+func (f fees) byEntry() map[Entry]decimal.Decimal {
+	out := make(map[Entry]decimal.Decimal, 4)
+	for entry, v := range map[Entry]*big.Int{
+		EntryFeeStorage: f.storage,
+		EntryFeeCompute: f.compute,
+		EntryFeeAction:  f.action,
+		EntryFeeForward: f.forward,
+	} {
+		if v.Sign() != 0 {
+			out[entry] = nanoToTON(v)
+		}
+	}
+	return out
+}
+
+func nanoToTON(nano *big.Int) decimal.Decimal {
+	return decimal.NewFromBigInt(nano, -tonDecimals)
+}
+
+func (f fees) total() *big.Int {
+	total := new(big.Int).Add(f.storage, f.compute)
+	total.Add(total, f.action)
+	return total.Add(total, f.forward)
+}
@@ -0,0 +1,62 @@
+package syncer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+)
+
+func TestParseFees(t *testing.T) {
+	account := address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+
+	unchanged := tlb.AccStatusChange{Type: tlb.AccStatusChangeUnchanged}
+	actionFees := tlb.FromNanoTONU(20_000)
+	withPhases := ordinary()
+	withPhases.StoragePhase = &tlb.StoragePhase{StorageFeesCollected: tlb.FromNanoTONU(1_000), StatusChange: unchanged}
+	withPhases.ActionPhase = &tlb.ActionPhase{
+		Success:         true,
+		Valid:           true,
+		StatusChange:    unchanged,
+		TotalActionFees: &actionFees,
+		ActionListHash:  make([]byte, 32),
+		TotalMsgSize:    tlb.StorageUsedShort{Cells: new(big.Int), Bits: new(big.Int)},
+	}
+
+	tests := []struct {
+		name                     string
+		tx                       testTx
+		storage, compute, action int64
+	}{
+		{
+			name:    "ordinary without phases",
+			tx:      testTx{account: account, totalFees: tlb.FromNanoTONU(300_000), description: ordinary()},
+			compute: 300_000,
+		},
+		{
+			name:    "ordinary with storage and action phases",
+			tx:      testTx{account: account, totalFees: tlb.FromNanoTONU(300_000), description: withPhases},
+			storage: 1_000,
+			compute: 279_000,
+			action:  20_000,
+		},
+		{
+			name: "storage",
+			tx: testTx{account: account, totalFees: tlb.FromNanoTONU(5_000), description: tlb.TransactionDescriptionStorage{
+				StoragePhase: tlb.StoragePhase{StorageFeesCollected: tlb.FromNanoTONU(5_000), StatusChange: unchanged},
+			}},
+			storage: 5_000,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := tc.tx.parse(t).fees
+			if f.storage.Int64() != tc.storage || f.compute.Int64() != tc.compute || f.action.Int64() != tc.action {
+				t.Errorf("got storage %s, compute %s, action %s; want %d, %d, %d",
+					f.storage, f.compute, f.action, tc.storage, tc.compute, tc.action)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tl"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// ErrUnverified is returned when liteserver's response can't be verified with proofs.
+var ErrUnverified = errors.New("liteserver response is not verified")
+
+// fetchedTx is a transaction together with its serialized form and the block it was included in.
+type fetchedTx struct {
+	tx    *tlb.Transaction
+	root  *cell.Cell
+	boc   []byte
+	block *ton.BlockIDExt
+}
+
+// listTransactions works like ton.APIClient.ListTransactions but keeps raw BOCs and block ids
+// liteserver returns along with transactions. The oldest transaction is first.
+func (s *Syncer) listTransactions(
+	ctx context.Context,
+	addr *address.Address,
+	limit uint32,
+	lt uint64,
+	txHash []byte,
+) ([]*fetchedTx, error) {
+	var resp tl.Serializable
+	err := s.ton.Client().QueryLiteserver(ctx, ton.GetTransactions{
+		Limit:  int32(limit),
+		AccID:  &ton.AccountID{Workchain: addr.Workchain(), ID: addr.Data()},
+		LT:     int64(lt),
+		TxHash: txHash,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case ton.TransactionList:
+		if len(t.Transactions) == 0 {
+			return nil, ton.ErrNoTransactionsWereFound
+		}
+
+		roots, err := cell.FromBOCMultiRoot(t.Transactions)
+		if err != nil {
+			return nil, fmt.Errorf("parse cell from transaction bytes: %w", err)
+		}
+		if len(roots) != len(t.IDs) {
+			return nil, fmt.Errorf("got %d block ids for %d transactions", len(t.IDs), len(roots))
+		}
+
+		res := make([]*fetchedTx, len(roots))
+		for i := len(roots) - 1; i >= 0; i-- {
+			var tx tlb.Transaction
+			if err := tlb.LoadFromCell(&tx, roots[i].BeginParse()); err != nil {
+				return nil, fmt.Errorf("load transaction from cell: %w", err)
+			}
+			tx.Hash = roots[i].Hash()
+
+			if !bytes.Equal(txHash, tx.Hash) {
+				return nil, errors.New("incorrect transaction hash, not matches prev tx hash")
+			}
+			txHash = tx.PrevTxHash
+
+			res[i] = &fetchedTx{tx: &tx, root: roots[i], boc: roots[i].ToBOC(), block: t.IDs[i]}
+		}
+
+		if s.cfg.VerifyProofs {
+			for _, f := range res {
+				if err := s.verifyInclusion(ctx, addr, f); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return res, nil
+	case ton.LSError:
+		if t.Code == 0 {
+			return nil, ton.ErrNoTransactionsWereFound
+		}
+		return nil, t
+	}
+
+	return nil, errors.New("unknown response type")
+}
+
+func transactionsOf(fetched []*fetchedTx) []*tlb.Transaction {
+	out := make([]*tlb.Transaction, len(fetched))
+	for i, f := range fetched {
+		out[i] = f.tx
+	}
+	return out
+}
+
+func castRawTransactions(fetched []*fetchedTx, accountID int) []RawTransaction {
+	out := make([]RawTransaction, len(fetched))
+	for i, f := range fetched {
+		out[i] = RawTransaction{
+			AccountID:      accountID,
+			CryptoHash:     txHashToString(f.tx.Hash),
+			CryptoTonLT:    f.tx.LT,
+			BOC:            f.boc,
+			BlockWorkchain: f.block.Workchain,
+			BlockShard:     f.block.Shard,
+			BlockSeqno:     f.block.SeqNo,
+			BlockRootHash:  txHashToString(f.block.RootHash),
+			BlockFileHash:  txHashToString(f.block.FileHash),
+		}
+	}
+	return out
+}
+
+// verifyInclusion checks the proof of transaction being included in the block liteserver says it is in.
+// Transactions themselves are verified by the hash chain, which is only as trusted as the hash the job starts at:
+// the proven account state for jobs enqueued by the actualizer and the reconciler and for their next pages,
+// but a stored row's previous hash for gap repairs.
+func (s *Syncer) verifyInclusion(ctx context.Context, addr *address.Address, f *fetchedTx) error {
+	proven, err := s.ton.GetTransaction(ctx, f.block, addr, f.tx.LT)
+	if err != nil {
+		return fmt.Errorf("%w: transaction %s inclusion: %w", ErrUnverified, txHashToString(f.tx.Hash), err)
+	}
+	if !bytes.Equal(proven.Hash, f.tx.Hash) {
+		return fmt.Errorf("%w: block has another transaction at lt %d", ErrUnverified, f.tx.LT)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+)
+
+const anchorBatchSize = 100
+
+// setStatus marks rows committed less than ConfirmationDepth masterchain blocks ago as pending.
+func (s *Syncer) setStatus(ctx context.Context, txs []Transaction) error {
+	if s.cfg.ConfirmationDepth == 0 {
+		for i := range txs {
+			txs[i].Status = TxStatusConfirmed
+		}
+		return nil
+	}
+
+	head, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	for i := range txs {
+		txs[i].Status = s.statusAt(txs[i].MasterchainSeqno, head.SeqNo)
+	}
+	return nil
+}
+
+// statusAt returns status of a row committed in the given masterchain block when head is the latest one.
+// Rows with unknown masterchain block are pending.
+func (s *Syncer) statusAt(masterchainSeqno *uint32, head uint32) TxStatus {
+	if s.cfg.ConfirmationDepth == 0 {
+		return TxStatusConfirmed
+	}
+	if masterchainSeqno == nil || head < *masterchainSeqno+s.cfg.ConfirmationDepth {
+		return TxStatusPending
+	}
+	return TxStatusConfirmed
+}
+
+// promoter periodically promotes pending rows deep enough to confirmed until ctx is done.
+func (s *Syncer) promoter(ctx context.Context) {
+	for range timeutils.TickWithCtx(ctx, s.cfg.AccountsCheckInterval) {
+		if err := s.promote(ctx); err != nil {
+			s.logger.Error("promoter: failed", zap.Error(err))
+		}
+	}
+}
+
+func (s *Syncer) promote(ctx context.Context) error {
+	if err := s.anchorPending(ctx); err != nil {
+		return fmt.Errorf("anchor pending: %w", err)
+	}
+
+	head, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("ton current masterchain info: %w", err)
+	}
+	if head.SeqNo < s.cfg.ConfirmationDepth {
+		return nil
+	}
+
+	confirmed, err := s.storage.ConfirmTransactions(ctx, head.SeqNo-s.cfg.ConfirmationDepth)
+	if err != nil {
+		return fmt.Errorf("storage confirm transactions: %w", err)
+	}
+	transactionsConfirmed.Add(float64(confirmed))
+
+	return nil
+}
+
+// anchorPending finds masterchain blocks committing pending rows which didn't have one when they were stored.
+// All such rows are walked page by page, rows whose block can't be resolved yet are left for the next pass.
+func (s *Syncer) anchorPending(ctx context.Context) error {
+	var afterID int
+	for {
+		txs, err := s.storage.GetUnanchoredTransactions(ctx, afterID, anchorBatchSize)
+		if err != nil {
+			return fmt.Errorf("storage get unanchored transactions: %w", err)
+		}
+		if len(txs) == 0 {
+			return nil
+		}
+		afterID = txs[len(txs)-1].ID
+
+		anchored := make([]Transaction, 0, len(txs))
+		for _, tx := range txs {
+			masterSeqno, err := s.anchor(ctx, tx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				s.logger.Warn("promoter: failed to anchor transaction", zap.Int("transaction_id", tx.ID), zap.Error(err))
+				continue
+			}
+			if masterSeqno == nil {
+				continue
+			}
+
+			tx.MasterchainSeqno = masterSeqno
+			anchored = append(anchored, *tx)
+		}
+
+		if len(anchored) == 0 {
+			continue
+		}
+
+		if err := s.storage.SetTransactionsMasterchainSeqno(ctx, anchored); err != nil {
+			return fmt.Errorf("storage set transactions masterchain seqno: %w", err)
+		}
+	}
+}
+
+// anchor returns seqno of the masterchain block committing the row's block or nil if it's not found yet.
+func (s *Syncer) anchor(ctx context.Context, tx *Transaction) (*uint32, error) {
+	block, err := s.ton.LookupBlock(ctx, *tx.BlockWorkchain, *tx.BlockShard, *tx.BlockSeqno)
+	if err != nil {
+		return nil, fmt.Errorf("lookup block: %w", err)
+	}
+
+	masterSeqno, err := s.masterchainSeqno(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("find masterchain block: %w", err)
+	}
+	return masterSeqno, nil
+}
@@ -0,0 +1,132 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrActualizersStalled = errors.New("actualizers made no progress")
+	ErrUpdaterStuck       = errors.New("updater job is stuck")
+	ErrUpdatersStalled    = errors.New("updaters made no progress while queue is not empty")
+	ErrMasterchainStale   = errors.New("masterchain head is stale")
+)
+
+// progress keeps track of when actualizers and updaters last finished an attempt, failed or not,
+// which updater attempts are still running and what masterchain head was seen.
+type progress struct {
+	actualizer atomic.Int64 // unix nano of the last finished actualizer iteration
+	updater    atomic.Int64 // unix nano of the last finished updater attempt
+
+	mu          sync.Mutex
+	lastAttempt uint64
+	running     map[uint64]time.Time // start of updater attempts in progress by attempt number
+	headSeqno   uint32
+	headSeenAt  time.Time
+}
+
+func (p *progress) reset(now time.Time) {
+	p.actualizer.Store(now.UnixNano())
+	p.updater.Store(now.UnixNano())
+}
+
+// startUpdate registers an updater attempt started at now and returns its number to finish it with.
+func (p *progress) startUpdate(now time.Time) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running == nil {
+		p.running = make(map[uint64]time.Time)
+	}
+	p.lastAttempt++
+	p.running[p.lastAttempt] = now
+	return p.lastAttempt
+}
+
+// finishUpdate records the updater attempt as finished at now, whatever its result is.
+func (p *progress) finishUpdate(attempt uint64, now time.Time) {
+	p.mu.Lock()
+	delete(p.running, attempt)
+	p.mu.Unlock()
+
+	p.updater.Store(now.UnixNano())
+}
+
+// longestUpdate returns how long the oldest updater attempt in progress has been running, 0 if there is none.
+func (p *progress) longestUpdate(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var longest time.Duration
+	for _, start := range p.running {
+		if d := now.Sub(start); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// CheckLiveness returns an error if actualizers haven't finished any iteration or an updater attempt has been running
+// for longer than HealthProgressWindow. Only in-process state is checked, failed attempts count as progress,
+// so outages of the database or liteservers don't make the syncer look stuck.
+func (s *Syncer) CheckLiveness(_ context.Context) error {
+	window, now := s.cfg.HealthProgressWindow, time.Now()
+
+	if since := now.Sub(time.Unix(0, s.progress.actualizer.Load())); since > window {
+		return fmt.Errorf("%w for %s", ErrActualizersStalled, since.Truncate(time.Second))
+	}
+
+	if running := s.progress.longestUpdate(now); running > window {
+		return fmt.Errorf("%w: running for %s", ErrUpdaterStuck, running.Truncate(time.Second))
+	}
+
+	return nil
+}
+
+// CheckQueue returns an error if updaters haven't finished any attempt within HealthProgressWindow
+// while there are queued jobs.
+func (s *Syncer) CheckQueue(ctx context.Context) error {
+	since := time.Since(time.Unix(0, s.progress.updater.Load()))
+	if since <= s.cfg.HealthProgressWindow {
+		return nil
+	}
+
+	stats, err := s.storage.GetQueueStats(ctx, queueType)
+	if err != nil {
+		return fmt.Errorf("get queue stats: %w", err)
+	}
+	if stats.Depth > 0 {
+		return fmt.Errorf("%w for %s, %d jobs queued", ErrUpdatersStalled, since.Truncate(time.Second), stats.Depth)
+	}
+
+	return nil
+}
+
+// CheckLiteserver returns an error if liteserver is unreachable or its masterchain head
+// hasn't moved for longer than HealthMaxHeadAge.
+func (s *Syncer) CheckLiteserver(ctx context.Context) error {
+	head, err := s.ton.GetMasterchainInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("ton get masterchain info: %w", err)
+	}
+
+	s.progress.mu.Lock()
+	defer s.progress.mu.Unlock()
+
+	now := time.Now()
+	if head.SeqNo > s.progress.headSeqno || s.progress.headSeenAt.IsZero() {
+		s.progress.headSeqno = head.SeqNo
+		s.progress.headSeenAt = now
+		return nil
+	}
+
+	if age := now.Sub(s.progress.headSeenAt); age > s.cfg.HealthMaxHeadAge {
+		return fmt.Errorf("%w: seqno %d unchanged for %s", ErrMasterchainStale, head.SeqNo, age.Truncate(time.Second))
+	}
+
+	return nil
+}
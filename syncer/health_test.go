@@ -0,0 +1,59 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckLiveness(t *testing.T) {
+	window := time.Minute
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		prepare func(p *progress)
+		wantErr error
+	}{
+		{
+			name:    "fresh",
+			prepare: func(p *progress) {},
+		},
+		{
+			name:    "actualizers stalled",
+			prepare: func(p *progress) { p.actualizer.Store(now.Add(-2 * window).UnixNano()) },
+			wantErr: ErrActualizersStalled,
+		},
+		{
+			name: "failed updater attempt is progress",
+			prepare: func(p *progress) {
+				p.finishUpdate(p.startUpdate(now.Add(-2*window)), now) // retry delay runs after the attempt is finished
+			},
+		},
+		{
+			name:    "updater stuck",
+			prepare: func(p *progress) { p.startUpdate(now.Add(-2 * window)) },
+			wantErr: ErrUpdaterStuck,
+		},
+		{
+			name: "idle updaters",
+			prepare: func(p *progress) {
+				p.updater.Store(now.Add(-2 * window).UnixNano()) // queue depth is a readiness concern
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Syncer{cfg: Config{HealthProgressWindow: window}}
+			s.progress.reset(now)
+			tc.prepare(&s.progress)
+
+			err := s.CheckLiveness(context.Background())
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("got %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+)
+
+func TestInternalTransfers(t *testing.T) {
+	var (
+		self     = address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+		tracked  = address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+		tracked2 = address.MustParseAddr("EQBfBWT7X2BHg9tXAxzhz2aKiNTU1tpt5NsiK0uSDW_YAJ67")
+		external = address.MustParseAddr("EQAYqo4u7VF0fa4DPAebk4g9lBytj2VFny7pzXR0trjtXQaO")
+	)
+	accounts := map[string]*Account{rawAddr(self): {ID: 1}, rawAddr(tracked): {ID: 2}, rawAddr(tracked2): {ID: 3}}
+
+	send := func(to *address.Address, ton string) *tlb.InternalMessage {
+		return &tlb.InternalMessage{SrcAddr: self, DstAddr: to, Amount: tlb.MustFromTON(ton)}
+	}
+
+	tests := []struct {
+		name         string
+		out          []*tlb.InternalMessage
+		wantInternal bool
+		wantMsgHash  bool
+		wantLinked   []int // indexes of out messages to link
+	}{
+		{
+			name:         "single tracked",
+			out:          []*tlb.InternalMessage{send(tracked, "1")},
+			wantInternal: true,
+			wantMsgHash:  true,
+			wantLinked:   []int{0},
+		},
+		{
+			name:         "batch of tracked",
+			out:          []*tlb.InternalMessage{send(tracked, "1"), send(tracked2, "2")},
+			wantInternal: true,
+			wantLinked:   []int{0, 1},
+		},
+		{
+			name:       "mixed batch, external last",
+			out:        []*tlb.InternalMessage{send(tracked, "1"), send(external, "2")},
+			wantLinked: []int{0},
+		},
+		{
+			name:       "mixed batch, tracked last",
+			out:        []*tlb.InternalMessage{send(external, "2"), send(tracked, "1")},
+			wantLinked: []int{1},
+		},
+		{
+			name:         "tracked with empty notification to external",
+			out:          []*tlb.InternalMessage{send(tracked, "1"), send(external, "0")},
+			wantInternal: true,
+			wantLinked:   []int{0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed := testTx{account: self, out: tc.out, description: ordinary()}.parse(t)
+
+			rows, err := castTransactions([]*parseTxResult{parsed}, 1, 1, 0, nil, accounts, defaultDecoders(), nil)
+			if err != nil {
+				t.Fatalf("cast transactions: %v", err)
+			}
+			value := rows[0]
+			if value.Internal != tc.wantInternal {
+				t.Errorf("got internal %t, want %t", value.Internal, tc.wantInternal)
+			}
+			if (value.CryptoMsgHash != nil) != tc.wantMsgHash {
+				t.Errorf("got message hash %v, want one %t", value.CryptoMsgHash, tc.wantMsgHash)
+			}
+
+			linked := internalMsgHashes([]*parseTxResult{parsed}, rows, accounts, 1)
+			if len(linked) != len(tc.wantLinked) {
+				t.Fatalf("got %d linked messages, want %d", len(linked), len(tc.wantLinked))
+			}
+			for i, idx := range tc.wantLinked {
+				if want := *msgHash(mustMsgCell(t, tc.out[idx])); linked[i] != want {
+					t.Errorf("got linked message %s, want %s", linked[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package syncer
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+	"go.uber.org/zap"
+)
+
+const (
+	opJettonTransfer             = 0x0f8a7ea5
+	opJettonTransferNotification = 0x7362d09c
+	opBounced                    = 0xffffffff
+
+	defaultJettonDecimals = 9
+)
+
+type jettonTransferNotification struct {
+	_              tlb.Magic        `tlb:"#7362d09c"`
+	QueryID        uint64           `tlb:"## 64"`
+	Amount         tlb.Coins        `tlb:"."`
+	Sender         *address.Address `tlb:"addr"`
+	ForwardPayload *cell.Cell       `tlb:"either . ^"`
+}
+
+// jettonTransfer is a jetton movement found in a transaction of the wallet owner.
+type jettonTransfer struct {
+	wallet       *address.Address // owner's jetton wallet the message was sent to or received from
+	counterparty *address.Address
+	amount       *big.Int // signed amount in jetton's minimal units
+	comment      string
+
+	// transfer between owners as both of them see it, not set for bounces
+	queryID  uint64
+	from, to *address.Address
+}
+
+// msgHash returns hash identifying the transfer between owners, it's nil for bounces.
+// Sender's transfer request and receiver's notification are different messages, so the hash
+// is taken of what both of them carry: jetton, query id, amount and both owners.
+func (j *jettonTransfer) msgHash(asset *jettonAsset) *string {
+	if j.from == nil || j.to == nil {
+		return nil
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s:%d:%s:%s:%s", asset.master, j.queryID, new(big.Int).Abs(j.amount), rawAddr(j.from), rawAddr(j.to))
+	hash := txHashToString(h.Sum(nil))
+	return &hash
+}
+
+// jettonAsset is where transfers of one jetton master land.
+type jettonAsset struct {
+	master   string
+	assetID  int
+	decimals int32
+}
+
+// jettonResolver returns asset of the jetton the given wallet belongs to or nil if jetton is not mapped to any asset.
+type jettonResolver func(wallet *address.Address) (*jettonAsset, error)
+
+func (j *jettonAsset) amount(raw *big.Int) decimal.Decimal {
+	return decimal.NewFromBigInt(raw, -j.decimals)
+}
+
+// parseJettonNotification parses incoming transfer_notification sent by the owner's jetton wallet.
+func parseJettonNotification(msg *tlb.InternalMessage) (*jettonTransfer, error) {
+	var n jettonTransferNotification
+	if err := tlb.LoadFromCell(&n, msg.Body.BeginParse()); err != nil {
+		return nil, fmt.Errorf("load transfer notification: %w", err)
+	}
+
+	return &jettonTransfer{
+		wallet:       msg.SrcAddr,
+		counterparty: n.Sender,
+		amount:       n.Amount.Nano(),
+		comment:      payloadComment(n.ForwardPayload),
+		queryID:      n.QueryID,
+		from:         n.Sender,
+		to:           msg.DstAddr,
+	}, nil
+}
+
+// parseJettonTransfer parses outgoing transfer request sent to the owner's jetton wallet.
+func parseJettonTransfer(msg *tlb.InternalMessage) (*jettonTransfer, error) {
+	var t jetton.TransferPayload
+	if err := tlb.LoadFromCell(&t, msg.Body.BeginParse()); err != nil {
+		return nil, fmt.Errorf("load transfer: %w", err)
+	}
+
+	return &jettonTransfer{
+		wallet:       msg.DstAddr,
+		counterparty: t.Destination,
+		amount:       new(big.Int).Neg(t.Amount.Nano()),
+		comment:      payloadComment(t.ForwardPayload),
+		queryID:      t.QueryID,
+		from:         msg.SrcAddr,
+		to:           t.Destination,
+	}, nil
+}
+
+// parseJettonBounce parses transfer request bounced back by the jetton wallet, nil if the message is not one.
+// The wallet refused the transfer, so the amount is booked back. Bounced body keeps only the beginning
+// of the request without the destination, so the wallet is the counterparty of the reversal.
+func parseJettonBounce(msg *tlb.InternalMessage) *jettonTransfer {
+	slice := msg.Body.BeginParse()
+	if prefix, err := slice.LoadUInt(32); err != nil || prefix != opBounced {
+		return nil
+	}
+	if op, err := slice.LoadUInt(32); err != nil || op != opJettonTransfer {
+		return nil
+	}
+	if _, err := slice.LoadUInt(64); err != nil {
+		return nil
+	}
+	amount, err := slice.LoadBigCoins()
+	if err != nil {
+		return nil
+	}
+
+	return &jettonTransfer{wallet: msg.SrcAddr, counterparty: msg.SrcAddr, amount: amount}
+}
+
+// payloadComment returns text comment from forward payload or empty string if it's not a comment.
+func payloadComment(payload *cell.Cell) string {
+	if payload == nil {
+		return ""
+	}
+
+	slice := payload.BeginParse()
+	if op, err := slice.LoadUInt(32); err != nil || op != 0 {
+		return ""
+	}
+
+	comment, _ := slice.LoadStringSnake()
+	return comment
+}
+
+// resolveJetton finds jetton master of the wallet and returns asset it is mapped to.
+// Master is confirmed by asking it for the owner's wallet address, so contracts pretending to be
+// a wallet of a known jetton are treated as not mapped.
+func (s *Syncer) resolveJetton(ctx context.Context, wallet *address.Address) (*jettonAsset, error) {
+	key := rawAddr(wallet)
+	if cached, ok := s.jettonWallets.Get(key); ok {
+		return cached, nil
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	res, err := s.ton.RunGetMethod(ctx, block, wallet, "get_wallet_data")
+	var execErr ton.ContractExecError
+	if errors.As(err, &execErr) {
+		return s.notJettonWallet(key, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run get_wallet_data: %w", err)
+	}
+
+	owner, err := loadAddrResult(res, 1)
+	if err != nil {
+		return s.notJettonWallet(key, fmt.Errorf("load owner address: %w", err))
+	}
+
+	master, err := loadAddrResult(res, 2)
+	if err != nil {
+		return s.notJettonWallet(key, fmt.Errorf("load master address: %w", err))
+	}
+
+	asset, ok := s.jettonAssets[rawAddr(master)]
+	if !ok {
+		s.jettonWallets.Add(key, nil)
+		return nil, nil
+	}
+
+	expected, err := jetton.NewJettonMasterClient(s.ton, master).GetJettonWalletAtBlock(ctx, owner, block)
+	if err != nil {
+		return nil, fmt.Errorf("get jetton wallet: %w", err)
+	}
+	if rawAddr(expected.Address()) != key {
+		return s.notJettonWallet(key, fmt.Errorf("master %s doesn't confirm the wallet", master))
+	}
+
+	s.jettonWallets.Add(key, asset)
+	return asset, nil
+}
+
+// notJettonWallet remembers that wallet is not a wallet of any mapped jetton.
+func (s *Syncer) notJettonWallet(key string, reason error) (*jettonAsset, error) {
+	s.logger.Debug("jetton: address is not a wallet of any mapped jetton", zap.String("address", key), zap.Error(reason))
+	s.jettonWallets.Add(key, nil)
+	return nil, nil
+}
+
+func loadAddrResult(res *ton.ExecutionResult, index uint) (*address.Address, error) {
+	slice, err := res.Slice(index)
+	if err != nil {
+		return nil, err
+	}
+	return slice.LoadAddr()
+}
+
+// parseJettonAssets builds jetton assets by raw master address from config mappings.
+// Masters may be written in any form in both mappings, decimals of masters not mapped to an asset are an error.
+func parseJettonAssets(assets map[string]int, decimals map[string]int) (map[string]*jettonAsset, error) {
+	out := make(map[string]*jettonAsset, len(assets))
+	for master, assetID := range assets {
+		addr, err := parseAnyAddr(master)
+		if err != nil {
+			return nil, fmt.Errorf("parse jetton master %q: %w", master, err)
+		}
+
+		out[rawAddr(addr)] = &jettonAsset{master: addr.String(), assetID: assetID, decimals: defaultJettonDecimals}
+	}
+
+	for master, d := range decimals {
+		addr, err := parseAnyAddr(master)
+		if err != nil {
+			return nil, fmt.Errorf("parse jetton master %q of decimals: %w", master, err)
+		}
+
+		asset, ok := out[rawAddr(addr)]
+		if !ok {
+			return nil, fmt.Errorf("decimals of jetton master %q not mapped to an asset", master)
+		}
+		asset.decimals = int32(d)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+)
+
+func TestParseJettonAssets(t *testing.T) {
+	master := address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+	raw := rawAddr(master)
+
+	tests := []struct {
+		name     string
+		decimals map[string]int
+		want     int32
+		wantErr  bool
+	}{
+		{name: "default", want: defaultJettonDecimals},
+		{name: "same form", decimals: map[string]int{master.String(): 6}, want: 6},
+		{name: "raw form", decimals: map[string]int{raw: 6}, want: 6},
+		{name: "non-bounceable form", decimals: map[string]int{master.Bounce(false).String(): 6}, want: 6},
+		{name: "unmapped master", decimals: map[string]int{"EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N": 6}, wantErr: true},
+		{name: "malformed master", decimals: map[string]int{"not an address": 6}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assets, err := parseJettonAssets(map[string]int{master.String(): 2}, tc.decimals)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			asset := assets[raw]
+			if asset == nil {
+				t.Fatalf("asset of %s not found", raw)
+			}
+			if asset.assetID != 2 || asset.decimals != tc.want {
+				t.Errorf("got asset %d with %d decimals, want 2 with %d", asset.assetID, asset.decimals, tc.want)
+			}
+		})
+	}
+}
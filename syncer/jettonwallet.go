@@ -0,0 +1,287 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+const (
+	opJettonInternalTransfer = 0x178d4519
+	opJettonBurn             = 0x595f07bc
+	opJettonBurnNotification = 0x7bdd97de
+)
+
+// ErrJettonNotMapped is returned when jetton wallet account belongs to a jetton missing in Config.JettonAssets.
+var ErrJettonNotMapped = errors.New("jetton is not mapped to any asset")
+
+type jettonInternalTransfer struct {
+	_                tlb.Magic        `tlb:"#178d4519"`
+	QueryID          uint64           `tlb:"## 64"`
+	Amount           tlb.Coins        `tlb:"."`
+	From             *address.Address `tlb:"addr"`
+	ResponseAddress  *address.Address `tlb:"addr"`
+	ForwardTONAmount tlb.Coins        `tlb:"."`
+	ForwardPayload   *cell.Cell       `tlb:"either . ^"`
+}
+
+// walletMovement is a change of jetton wallet balance made by its transaction.
+type walletMovement struct {
+	amount       *big.Int // signed amount in jetton's minimal units
+	counterparty *address.Address
+	comment      string
+}
+
+// castWalletTransactions casts transactions of a jetton wallet account into one jetton row per transaction,
+// zero for transactions not changing its balance. TON the wallet receives and spends on fees is attached
+// by its owner, so it's left to the owner's rows.
+func castWalletTransactions(
+	in []*parseTxResult,
+	accountID int,
+	asset *jettonAsset,
+	decoders Decoders,
+) ([]Transaction, error) {
+	master, err := address.ParseAddr(asset.master)
+	if err != nil {
+		return nil, fmt.Errorf("parse master: %w", err)
+	}
+
+	out := make([]Transaction, 0, len(in))
+
+	// reverse order from older to newer to from newer to older to make ids order clear
+	for i := len(in) - 1; i >= 0; i-- {
+		parsed := in[i]
+		tx := parsed.tx
+
+		movement := parseWalletMovement(tx, master)
+		kind, details := decoders.decode(parsed.body)
+
+		row := Transaction{
+			AccountID:      accountID,
+			AssetID:        asset.assetID,
+			Amount:         asset.amount(movement.amount),
+			Comment:        movement.comment,
+			CryptoHash:     &parsed.hash,
+			CryptoTonLT:    &tx.LT,
+			CryptoOpCode:   parsed.opCode,
+			CryptoJetton:   &asset.master,
+			CryptoEntry:    EntryJetton,
+			CryptoMsgHash:  parsed.inMsgHash,
+			CryptoPrevHash: &parsed.prevHash,
+			CryptoPrevLT:   &tx.PrevTxLT,
+			Kind:           kind,
+			Details:        details,
+			EffectiveAt:    parsed.effectiveAt,
+		}
+		if movement.counterparty != nil {
+			counterparty := movement.counterparty.String()
+			row.Merchant, row.CryptoCounterparty = counterparty, &counterparty
+		}
+		out = append(out, row)
+	}
+
+	return out, nil
+}
+
+// parseWalletMovement returns how the jetton wallet balance was changed by the message it received.
+// Aborted transactions roll back the balance, so they change nothing.
+func parseWalletMovement(tx *tlb.Transaction, master *address.Address) walletMovement {
+	none := walletMovement{amount: new(big.Int)}
+	if tx.IO.In == nil || tx.IO.In.MsgType != tlb.MsgTypeInternal {
+		return none
+	}
+	if d, ok := tx.Description.Description.(tlb.TransactionDescriptionOrdinary); ok && d.Aborted {
+		return none
+	}
+
+	msg := tx.IO.In.AsInternal()
+	op := opCode(msg.Body)
+	if op == nil {
+		return none
+	}
+
+	switch *op {
+	case opJettonInternalTransfer:
+		var t jettonInternalTransfer
+		if err := tlb.LoadFromCell(&t, msg.Body.BeginParse()); err != nil {
+			return none
+		}
+		return walletMovement{amount: t.Amount.Nano(), counterparty: t.From, comment: payloadComment(t.ForwardPayload)}
+	case opJettonTransfer:
+		var t jetton.TransferPayload
+		if err := tlb.LoadFromCell(&t, msg.Body.BeginParse()); err != nil {
+			return none
+		}
+		return walletMovement{amount: new(big.Int).Neg(t.Amount.Nano()), counterparty: t.Destination, comment: payloadComment(t.ForwardPayload)}
+	case opJettonBurn:
+		var b jetton.BurnPayload
+		if err := tlb.LoadFromCell(&b, msg.Body.BeginParse()); err != nil {
+			return none
+		}
+		return walletMovement{amount: new(big.Int).Neg(b.Amount.Nano()), counterparty: master}
+	case opBounced:
+		// amount sent to another wallet or burned comes back, bounced body keeps the beginning of the request
+		slice := msg.Body.BeginParse()
+		_, _ = slice.LoadUInt(32)
+		if bounced, err := slice.LoadUInt(32); err != nil || (bounced != opJettonInternalTransfer && bounced != opJettonBurnNotification) {
+			return none
+		}
+		if _, err := slice.LoadUInt(64); err != nil {
+			return none
+		}
+		amount, err := slice.LoadBigCoins()
+		if err != nil {
+			return none
+		}
+		return walletMovement{amount: amount, counterparty: msg.SrcAddr}
+	}
+
+	return none
+}
+
+// discoverJettonWallets stores deployed wallets of the owner of the given jettons as child accounts of the owner.
+// Wallets are derived from the owner address by their masters, so only genuine wallets are stored.
+// Not deployed wallets are checked again on the next call.
+func (s *Syncer) discoverJettonWallets(ctx context.Context, owner *Account, assets []*jettonAsset) error {
+	ownerAddr, err := parseAnyAddr(*owner.CryptoAddress)
+	if err != nil {
+		return fmt.Errorf("parse owner addr: %w", err)
+	}
+
+	var block *ton.BlockIDExt
+	var wallets []Account
+	var keys []string
+	for _, asset := range assets {
+		key := strconv.Itoa(owner.ID) + ":" + asset.master
+		if _, ok := s.jettonWalletAccounts.Load(key); ok {
+			continue
+		}
+
+		if block == nil {
+			if block, err = s.ton.CurrentMasterchainInfo(ctx); err != nil {
+				return fmt.Errorf("ton current masterchain info: %w", err)
+			}
+		}
+
+		master, err := address.ParseAddr(asset.master)
+		if err != nil {
+			return fmt.Errorf("parse master: %w", err)
+		}
+
+		wallet, err := jetton.NewJettonMasterClient(s.ton, master).GetJettonWalletAtBlock(ctx, ownerAddr, block)
+		if err != nil {
+			return fmt.Errorf("get %s wallet: %w", asset.master, err)
+		}
+
+		tonAcc, err := s.ton.GetAccount(ctx, block, wallet.Address())
+		if err != nil {
+			return fmt.Errorf("ton get account: %w", err)
+		}
+		if !tonAcc.IsActive {
+			continue
+		}
+
+		walletAddr, masterAddr, parentID := wallet.Address().String(), asset.master, owner.ID
+		wallets = append(wallets, Account{
+			UserID:             owner.UserID,
+			Name:               fmt.Sprintf("%s: jetton %s", owner.Name, asset.master),
+			MainAssetID:        asset.assetID,
+			CryptoAddress:      &walletAddr,
+			CryptoBlockchainID: owner.CryptoBlockchainID,
+			ParentAccountID:    &parentID,
+			CryptoJetton:       &masterAddr,
+		})
+		keys = append(keys, key)
+	}
+
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	if err := s.storage.CreateJettonWalletAccounts(ctx, wallets); err != nil {
+		return fmt.Errorf("storage create jetton wallet accounts: %w", err)
+	}
+	for _, key := range keys {
+		s.jettonWalletAccounts.Store(key, struct{}{})
+	}
+
+	return nil
+}
+
+// observedJettons returns mapped jettons moved by the given rows.
+func (s *Syncer) observedJettons(txs []Transaction) ([]*jettonAsset, error) {
+	seen := map[string]bool{}
+	var out []*jettonAsset
+	for _, tx := range txs {
+		if tx.CryptoJetton == nil || seen[*tx.CryptoJetton] {
+			continue
+		}
+		seen[*tx.CryptoJetton] = true
+
+		master, err := parseAnyAddr(*tx.CryptoJetton)
+		if err != nil {
+			return nil, fmt.Errorf("parse jetton %q: %w", *tx.CryptoJetton, err)
+		}
+		if asset, ok := s.jettonAssets[rawAddr(master)]; ok {
+			out = append(out, asset)
+		}
+	}
+	return out, nil
+}
+
+// withoutJettonRows drops owner's jetton rows, so movements synced by child accounts aren't counted twice.
+func withoutJettonRows(txs []Transaction) []Transaction {
+	out := txs[:0]
+	for _, tx := range txs {
+		if tx.CryptoEntry != EntryJetton {
+			out = append(out, tx)
+		}
+	}
+	return out
+}
+
+// walletJetton returns jetton asset of the jetton wallet account.
+func (s *Syncer) walletJetton(jettonMaster string) (*jettonAsset, error) {
+	master, err := parseAnyAddr(jettonMaster)
+	if err != nil {
+		return nil, fmt.Errorf("parse jetton %q: %w", jettonMaster, err)
+	}
+
+	asset, ok := s.jettonAssets[rawAddr(master)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJettonNotMapped, jettonMaster)
+	}
+	return asset, nil
+}
+
+// jettonWalletBalance returns balance of the jetton wallet itself, zero if it's not deployed.
+func (s *Syncer) jettonWalletBalance(
+	ctx context.Context,
+	block *ton.BlockIDExt,
+	asset *jettonAsset,
+	wallet *address.Address,
+) (decimal.Decimal, error) {
+	res, err := s.ton.RunGetMethod(ctx, block, wallet, "get_wallet_data")
+	var execErr ton.ContractExecError
+	if errors.As(err, &execErr) && execErr.Code == ton.ErrCodeContractNotInitialized {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("run get_wallet_data: %w", err)
+	}
+
+	balance, err := res.Int(0)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("load balance: %w", err)
+	}
+	return asset.amount(balance), nil
+}
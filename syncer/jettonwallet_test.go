@@ -0,0 +1,95 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+func TestParseWalletMovement(t *testing.T) {
+	var (
+		master      = address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+		wallet      = address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+		owner       = address.MustParseAddr("EQB3ncyBUTjZUA5EnFKR5_EnOMI9V1tTEAAPaiU71gc4TiUt")
+		otherWallet = address.MustParseAddr("EQDa4VOnTYlLvDJ0gZjNYm5PXfSmmtL6Vs6A_CZEtXCNICq_")
+		recipient   = address.MustParseAddr("EQBfBWT7X2BHg9tXAxzhz2aKiNTU1tpt5NsiK0uSDW_YAJ67")
+	)
+
+	transfer := mustBody(t, &jetton.TransferPayload{
+		QueryID:             7,
+		Amount:              tlb.FromNanoTONU(500),
+		Destination:         recipient,
+		ResponseDestination: owner,
+		ForwardTONAmount:    tlb.ZeroCoins,
+	})
+	internalTransfer := mustBody(t, &jettonInternalTransfer{
+		QueryID:          7,
+		Amount:           tlb.FromNanoTONU(500),
+		From:             owner,
+		ResponseAddress:  owner,
+		ForwardTONAmount: tlb.ZeroCoins,
+	})
+	bouncedInternalTransfer := cell.BeginCell().
+		MustStoreUInt(opBounced, 32).
+		MustStoreUInt(opJettonInternalTransfer, 32).
+		MustStoreUInt(7, 64).
+		MustStoreBigCoins(tlb.FromNanoTONU(500).Nano()).
+		EndCell()
+
+	aborted := ordinary()
+	aborted.Aborted = true
+
+	tests := []struct {
+		name         string
+		in           *tlb.InternalMessage
+		description  tlb.TransactionDescriptionOrdinary
+		amount       int64
+		counterparty *address.Address
+	}{
+		{
+			name:         "transfer",
+			in:           &tlb.InternalMessage{SrcAddr: owner, DstAddr: wallet, Amount: tlb.MustFromTON("0.05"), Body: transfer},
+			description:  ordinary(),
+			amount:       -500,
+			counterparty: recipient,
+		},
+		{
+			name:        "aborted transfer",
+			in:          &tlb.InternalMessage{SrcAddr: owner, DstAddr: wallet, Amount: tlb.MustFromTON("0.05"), Body: transfer},
+			description: aborted,
+		},
+		{
+			name:         "internal transfer",
+			in:           &tlb.InternalMessage{SrcAddr: otherWallet, DstAddr: wallet, Amount: tlb.MustFromTON("0.05"), Body: internalTransfer},
+			description:  ordinary(),
+			amount:       500,
+			counterparty: owner,
+		},
+		{
+			name: "bounced internal transfer",
+			in: &tlb.InternalMessage{
+				Bounced: true, SrcAddr: otherWallet, DstAddr: wallet, Amount: tlb.MustFromTON("0.04"), Body: bouncedInternalTransfer,
+			},
+			description:  ordinary(),
+			amount:       500,
+			counterparty: otherWallet,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed := testTx{account: wallet, in: tc.in, totalFees: tlb.FromNanoTONU(1_000), description: tc.description}.parse(t)
+
+			m := parseWalletMovement(parsed.tx, master)
+			if m.amount.Int64() != tc.amount {
+				t.Errorf("got amount %s, want %d", m.amount, tc.amount)
+			}
+			if tc.counterparty != nil && (m.counterparty == nil || rawAddr(m.counterparty) != rawAddr(tc.counterparty)) {
+				t.Errorf("got counterparty %s, want %s", m.counterparty, tc.counterparty)
+			}
+		})
+	}
+}
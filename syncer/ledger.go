@@ -0,0 +1,193 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/address"
+)
+
+const ledgerFeesAccount = "expense:fees"
+
+// txMessage is an internal message of a transaction with amount signed from the account's point of view.
+type txMessage struct {
+	account      *address.Address // the account itself as the message addresses it
+	counterparty *address.Address
+	amount       decimal.Decimal
+	hash         string // hash of the message cell, sender's and receiver's transactions share it
+}
+
+// ledgerParty is a ledger account postings are made to.
+type ledgerParty struct {
+	account  string
+	id       *int    // tracked account, nil for external and expense accounts
+	replaces *string // external ledger account of the same address, set for tracked accounts
+}
+
+// ledgerEntry accumulates balanced postings of one entry by ledger account.
+type ledgerEntry struct {
+	key     string
+	assetID int
+	order   []string
+	amounts map[string]decimal.Decimal
+	parties map[string]ledgerParty
+}
+
+func newLedgerEntry(key string, assetID int) *ledgerEntry {
+	return &ledgerEntry{
+		key:     key,
+		assetID: assetID,
+		amounts: map[string]decimal.Decimal{},
+		parties: map[string]ledgerParty{},
+	}
+}
+
+// move posts amount to `to` and the same amount with opposite sign to `from`.
+func (e *ledgerEntry) move(from, to ledgerParty, amount decimal.Decimal) {
+	e.add(to, amount)
+	e.add(from, amount.Neg())
+}
+
+func (e *ledgerEntry) add(party ledgerParty, amount decimal.Decimal) {
+	if _, ok := e.amounts[party.account]; !ok {
+		e.order = append(e.order, party.account)
+		e.parties[party.account] = party
+	}
+	e.amounts[party.account] = e.amounts[party.account].Add(amount)
+}
+
+func (e *ledgerEntry) postings(template Posting) []Posting {
+	out := make([]Posting, 0, len(e.order))
+	for _, ledgerAccount := range e.order {
+		amount := e.amounts[ledgerAccount]
+		if amount.IsZero() {
+			continue
+		}
+
+		p := template
+		p.EntryKey = e.key
+		p.LedgerAccount = ledgerAccount
+		p.AccountID = e.parties[ledgerAccount].id
+		p.Replaces = e.parties[ledgerAccount].replaces
+		p.AssetID = e.assetID
+		p.Amount = amount
+		out = append(out, p)
+	}
+	return out
+}
+
+// castPostings builds ledger postings of the account's transactions.
+func castPostings(
+	in []*parseTxResult,
+	accountID int,
+	assetID int,
+	resolveJetton jettonResolver,
+	tracked map[string]*Account,
+) ([]Posting, error) {
+	var out []Posting
+	for _, parsed := range in {
+		tx := parsed.tx
+
+		var asset *jettonAsset
+		if parsed.jetton != nil && parsed.jetton.amount.Sign() != 0 {
+			var err error
+			if asset, err = resolveJetton(parsed.jetton.wallet); err != nil {
+				return nil, fmt.Errorf("resolve jetton: %w", err)
+			}
+		}
+
+		template := Posting{
+			Comment:     parsed.desc,
+			CryptoHash:  parsed.hash,
+			CryptoTonLT: tx.LT,
+			EffectiveAt: parsed.effectiveAt,
+		}
+		out = append(out, ledgerPostings(parsed, accountID, assetID, asset, tracked, template)...)
+	}
+
+	return out, nil
+}
+
+// ledgerPostings turns parsed transaction of the account into balanced postings: value moved between
+// the account and its counterparties, jetton moved the same way and fees moved to the fees expense account.
+// Every transfer is an entry keyed by its message, so the sender's and the receiver's transactions post the same
+// entry and it's stored once whichever of them is synced first. Postings of tracked accounts replace external ones
+// of their addresses, so the entry ends up the same whether the counterparty was tracked at the time or not.
+func ledgerPostings(
+	parsed *parseTxResult,
+	accountID int,
+	assetID int,
+	jetton *jettonAsset,
+	tracked map[string]*Account,
+	template Posting,
+) []Posting {
+	self := func(addr *address.Address) ledgerParty {
+		return ledgerParty{account: ledgerAccountOfID(accountID), id: &accountID, replaces: externalOf(addr)}
+	}
+	counterparty := func(addr *address.Address) ledgerParty {
+		if a, ok := tracked[rawAddr(addr)]; ok {
+			return ledgerParty{account: ledgerAccountOfID(a.ID), id: &a.ID, replaces: externalOf(addr)}
+		}
+		return ledgerParty{account: *externalOf(addr)}
+	}
+
+	var out []Posting
+	for _, m := range parsed.messages {
+		value := newLedgerEntry(m.hash+":value", assetID)
+		value.move(counterparty(m.counterparty), self(m.account), m.amount)
+		out = append(out, value.postings(template)...)
+	}
+
+	fee := newLedgerEntry(parsed.hash+":fee", assetID)
+	fee.move(self(nil), ledgerParty{account: ledgerFeesAccount}, nanoToTON(parsed.fees.total()))
+	out = append(out, fee.postings(template)...)
+
+	if jetton != nil && parsed.jetton != nil {
+		key, owner := parsed.hash, parsed.jetton.to // bounces are seen by the sender only
+		if hash := parsed.jetton.msgHash(jetton); hash != nil {
+			key = *hash
+		}
+		if parsed.jetton.amount.Sign() < 0 {
+			owner = parsed.jetton.from
+		}
+		j := newLedgerEntry(key+":jetton", jetton.assetID)
+		j.move(counterparty(parsed.jetton.counterparty), self(owner), jetton.amount(parsed.jetton.amount))
+		out = append(out, j.postings(template)...)
+	}
+
+	return out
+}
+
+func ledgerAccountOfID(accountID int) string {
+	return "account:" + strconv.Itoa(accountID)
+}
+
+func externalOf(addr *address.Address) *string {
+	if addr == nil {
+		return nil
+	}
+	external := "external:" + rawAddr(addr)
+	return &external
+}
+
+func (s *Syncer) postLedger(
+	ctx context.Context,
+	txs []*parseTxResult,
+	accountID int,
+	assetID int,
+	resolveJetton jettonResolver,
+	tracked map[string]*Account,
+) error {
+	postings, err := castPostings(txs, accountID, assetID, resolveJetton, tracked)
+	if err != nil {
+		return fmt.Errorf("cast postings: %w", err)
+	}
+
+	if err := s.storage.CreateLedgerPostings(ctx, postings); err != nil {
+		return fmt.Errorf("storage create ledger postings: %w", err)
+	}
+
+	return nil
+}
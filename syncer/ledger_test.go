@@ -0,0 +1,96 @@
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+)
+
+// ledgerTable keeps postings the way ledger_postings does: unique by entry and ledger account,
+// replaced external postings are deleted before inserting.
+type ledgerTable map[[2]string]Posting
+
+func (l ledgerTable) create(postings []Posting) {
+	for _, p := range postings {
+		if p.Replaces != nil {
+			delete(l, [2]string{p.EntryKey, *p.Replaces})
+		}
+	}
+	for _, p := range postings {
+		key := [2]string{p.EntryKey, p.LedgerAccount}
+		if _, ok := l[key]; !ok {
+			l[key] = p
+		}
+	}
+}
+
+func TestLedgerPostingsSyncOrder(t *testing.T) {
+	sender := address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+	receiver := address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+	accounts := map[string]*Account{rawAddr(sender): {ID: 1}, rawAddr(receiver): {ID: 2}}
+
+	msg := &tlb.InternalMessage{SrcAddr: sender, DstAddr: receiver, Amount: tlb.MustFromTON("1")}
+	txs := map[string]*parseTxResult{
+		"sender":   testTx{account: sender, out: []*tlb.InternalMessage{msg}, description: ordinary()}.parse(t),
+		"receiver": testTx{account: receiver, in: msg, description: ordinary()}.parse(t),
+	}
+	ids := map[string]int{"sender": 1, "receiver": 2}
+
+	tests := []struct {
+		name           string
+		order          []string
+		bothTrackedAt1 bool // whether the account synced second was already tracked when the first one was synced
+	}{
+		{name: "sender first", order: []string{"sender", "receiver"}, bothTrackedAt1: true},
+		{name: "receiver first", order: []string{"receiver", "sender"}, bothTrackedAt1: true},
+		{name: "sender first, receiver tracked later", order: []string{"sender", "receiver"}},
+		{name: "receiver first, sender tracked later", order: []string{"receiver", "sender"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			table := ledgerTable{}
+			for i, side := range tc.order {
+				tracked := accounts
+				if i == 0 && !tc.bothTrackedAt1 {
+					tracked = map[string]*Account{}
+					for raw, a := range accounts {
+						if a.ID == ids[side] {
+							tracked[raw] = a
+						}
+					}
+				}
+				table.create(ledgerPostings(txs[side], ids[side], 1, nil, tracked, Posting{}))
+			}
+
+			balances := map[string]decimal.Decimal{}
+			entries := map[string]decimal.Decimal{}
+			for _, p := range table {
+				balances[p.LedgerAccount] = balances[p.LedgerAccount].Add(p.Amount)
+				entries[p.EntryKey] = entries[p.EntryKey].Add(p.Amount)
+			}
+
+			for key, sum := range entries {
+				if !sum.IsZero() {
+					t.Errorf("entry %s is not balanced: %s", key, sum)
+				}
+			}
+			want := map[string]string{"account:1": "-1", "account:2": "1"}
+			if len(balances) != len(want) {
+				t.Errorf("got postings to %d ledger accounts, want %d", len(balances), len(want))
+			}
+			for account, amount := range balances {
+				if strings.HasPrefix(account, "external:") {
+					t.Errorf("got posting to %s of tracked account", account)
+					continue
+				}
+				if !amount.Equal(decimal.RequireFromString(want[account])) {
+					t.Errorf("got %s balance %s, want %s", account, amount, want[account])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+)
+
+const metricsNamespace = "ton_syncer"
+
+var (
+	actualizerIterations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "actualizer",
+		Name:      "iterations_total",
+		Help:      "Number of actualizer iterations by actualizer and result.",
+	}, []string{"actualizer", "result"})
+
+	actualizerAccounts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "actualizer",
+		Name:      "accounts_total",
+		Help:      "Number of accounts checked by actualizers by outcome (up_to_date, enqueued, not_initialized).",
+	}, []string{"outcome"})
+
+	updaterJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "updater",
+		Name:      "job_duration_seconds",
+		Help:      "Duration of updater jobs by outcome (up_to_date, synced, error).",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"outcome"})
+
+	updaterTransactionsInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "updater",
+		Name:      "transactions_inserted_total",
+		Help:      "Number of transactions passed to the storage by updaters.",
+	})
+
+	reconcilerAccounts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "reconciler",
+		Name:      "accounts_total",
+		Help:      "Number of accounts checked by reconciler by outcome (reconciled, discrepancy, behind).",
+	}, []string{"outcome"})
+
+	chainGapsFound = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "chain_verifier",
+		Name:      "gaps_found_total",
+		Help:      "Number of gaps found in stored transaction history.",
+	})
+
+	consensusResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consensus",
+		Name:      "responses_total",
+		Help:      "Number of confirming liteserver responses by outcome (agreed, disagreed, error).",
+	}, []string{"outcome"})
+
+	transactionsConfirmed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "promoter",
+		Name:      "transactions_confirmed_total",
+		Help:      "Number of pending rows promoted to confirmed.",
+	})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "queue",
+		Name:      "depth",
+		Help:      "Number of updater jobs waiting in the queue.",
+	})
+
+	queueOldestJobAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "queue",
+		Name:      "oldest_job_age_seconds",
+		Help:      "Age of the oldest updater job in the queue, zero if the queue is empty.",
+	})
+)
+
+const (
+	outcomeUpToDate       = "up_to_date"
+	outcomeEnqueued       = "enqueued"
+	outcomeNotInitialized = "not_initialized"
+	outcomeSynced         = "synced"
+	outcomeError          = "error"
+	outcomeReconciled     = "reconciled"
+	outcomeDiscrepancy    = "discrepancy"
+	outcomeBehind         = "behind"
+	outcomeAgreed         = "agreed"
+	outcomeDisagreed      = "disagreed"
+)
+
+// queueMonitor periodically exports updater queue depth and age until ctx is done.
+func (s *Syncer) queueMonitor(ctx context.Context) {
+	for range timeutils.TickWithCtx(ctx, s.cfg.AccountsCheckInterval) {
+		stats, err := s.storage.GetQueueStats(ctx, queueType)
+		if err != nil {
+			s.logger.Error("queue monitor: failed to get queue stats", zap.Error(err))
+			continue
+		}
+
+		queueDepth.Set(float64(stats.Depth))
+		if stats.OldestJobCreatedAt == nil {
+			queueOldestJobAge.Set(0)
+			continue
+		}
+		queueOldestJobAge.Set(time.Since(*stats.OldestJobCreatedAt).Seconds())
+	}
+}
@@ -1,22 +1,63 @@
 package syncer
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/shopspring/decimal"
 )
 
 type Transaction struct {
-	ID          int
-	AccountID   int
-	AssetID     int
-	CategoryID  int
-	Merchant    string
-	Amount      decimal.Decimal
-	Comment     string
-	CryptoHash  *string
-	CryptoTonLT *uint64
-	EffectiveAt time.Time
+	ID                 int
+	AccountID          int
+	AssetID            int
+	CategoryID         int
+	Merchant           string
+	Amount             decimal.Decimal
+	Comment            string
+	CryptoHash         *string
+	CryptoTonLT        *uint64
+	CryptoCounterparty *string // address of the other side, unlike Merchant it's never rewritten by rules
+	CryptoOpCode       *uint32 // op code of the message body if it has one
+	CryptoJetton       *string // jetton master address for jetton transfers
+	CryptoEntry        Entry   // tells apart rows of one on-chain transaction
+	CryptoMsgHash      *string // hash of the only message of the transaction or of the jetton transfer, same for both sides
+	Internal           bool    // whether the counterparty is another tracked account
+	CryptoPrevHash     *string // hash of the account's previous transaction, set on value rows
+	CryptoPrevLT       *uint64 // logical time of the account's previous transaction, 0 for the first one
+	BlockWorkchain     *int32  // id of the block transaction was included in
+	BlockShard         *int64
+	BlockSeqno         *uint32
+	MasterchainSeqno   *uint32 // seqno of the masterchain block committing the block
+	Status             TxStatus
+	Kind               Kind            // what the message the row comes from means, empty for fee rows
+	Details            json.RawMessage // decoded message body, nil if it has nothing to decode
+	EffectiveAt        time.Time
+}
+
+// TxStatus tells whether transaction is deep enough in the chain to be relied on.
+type TxStatus string
+
+const (
+	TxStatusPending   TxStatus = "pending"   // committed less than Config.ConfirmationDepth masterchain blocks ago
+	TxStatusConfirmed TxStatus = "confirmed" // committed at least Config.ConfirmationDepth masterchain blocks ago
+)
+
+// Entry is a kind of row produced from an on-chain transaction. Each transaction produces at most one row of each kind.
+type Entry string
+
+const (
+	EntryValue      Entry = "value"       // TON amount sent or received
+	EntryJetton     Entry = "jetton"      // jetton amount sent or received
+	EntryFeeStorage Entry = "fee_storage" // storage phase fee
+	EntryFeeCompute Entry = "fee_compute" // compute phase fee and anything else not explained by other fees
+	EntryFeeAction  Entry = "fee_action"  // action phase fee
+	EntryFeeForward Entry = "fee_forward" // forward fees of outgoing messages
+	EntryFee        Entry = "fee"         // total fee of a row stored before fees were split by type
+)
+
+func (e Entry) IsFee() bool {
+	return e != EntryValue && e != EntryJetton
 }
 
 type Account struct {
@@ -26,4 +67,205 @@ type Account struct {
 	MainAssetID        int
 	CryptoAddress      *string
 	CryptoBlockchainID *int
+	ParentAccountID    *int    // owner account of jetton wallet accounts
+	CryptoJetton       *string // jetton master of jetton wallet accounts
+}
+
+type QueueStats struct {
+	Depth              int
+	OldestJobCreatedAt *time.Time
+}
+
+type Direction string
+
+const (
+	DirectionIn  Direction = "in"
+	DirectionOut Direction = "out"
+)
+
+// Rule assigns CategoryID (and optionally rewrites Merchant) to transactions matching all of its non-nil conditions.
+type Rule struct {
+	ID            int
+	UserID        *int // nil for global rules
+	Priority      int  // rules with higher priority are tried first
+	Merchant      *string
+	CommentRegexp *string
+	MinAmount     *decimal.Decimal // compared with absolute amount
+	MaxAmount     *decimal.Decimal // compared with absolute amount
+	Direction     *Direction
+	Jetton        *string
+	OpCode        *uint32
+	CategoryID    int
+	MerchantLabel *string
+}
+
+// Posting is one side of a balanced ledger entry. Amounts of all postings of one entry sum up to zero.
+type Posting struct {
+	ID            int
+	EntryKey      string  // "<message hash>:value", "<tx hash>:fee" or "<transfer hash>:jetton"
+	LedgerAccount string  // "account:<id>" for tracked accounts, "external:<raw address>" or "expense:fees"
+	AccountID     *int    // tracked account the posting belongs to, nil for external and expense accounts
+	Replaces      *string // external ledger account of the tracked account's address, its posting of the entry is replaced
+	AssetID       int
+	Amount        decimal.Decimal // positive is debit, negative is credit
+	Comment       string
+	CryptoHash    string // hash of transaction the entry was produced from
+	CryptoTonLT   uint64
+	EffectiveAt   time.Time
+}
+
+// AccountState is a snapshot of account's on-chain state taken when the account is synced.
+type AccountState struct {
+	ID             int
+	AccountID      int
+	Status         AccountStatus
+	Interface      Interface       // detected by code, empty if account has no code
+	CodeHash       *string         // nil if account has no code
+	Balance        decimal.Decimal // in TON
+	LastTxLT       uint64
+	LastActivityAt *time.Time // when storage fee was last paid, every transaction pays it
+	CheckedAt      time.Time
+}
+
+type AccountStatus string
+
+const (
+	AccountStatusActive   AccountStatus = "active"
+	AccountStatusUninit   AccountStatus = "uninit" // has balance but no code yet
+	AccountStatusFrozen   AccountStatus = "frozen" // code and data are removed for unpaid storage
+	AccountStatusNonExist AccountStatus = "nonexist"
+)
+
+// Interface is a kind of contract detected by its code.
+type Interface string
+
+const (
+	InterfaceWalletV1     Interface = "wallet_v1"
+	InterfaceWalletV2     Interface = "wallet_v2"
+	InterfaceWalletV3R1   Interface = "wallet_v3r1"
+	InterfaceWalletV3R2   Interface = "wallet_v3r2"
+	InterfaceWalletV4R1   Interface = "wallet_v4r1"
+	InterfaceWalletV4R2   Interface = "wallet_v4r2"
+	InterfaceWalletV5     Interface = "wallet_v5"
+	InterfaceHighloadV2   Interface = "highload_v2"
+	InterfaceHighloadV3   Interface = "highload_v3"
+	InterfaceLockup       Interface = "lockup"
+	InterfaceJettonWallet Interface = "jetton_wallet"
+	InterfaceUnknown      Interface = "unknown"
+)
+
+// NFTTransfer is a change of NFT item owner seen in a transaction of a tracked account.
+type NFTTransfer struct {
+	ID          int
+	AccountID   int
+	Item        string    // NFT item address
+	Collection  *string   // collection address, nil for items outside of any collection
+	From        *string   // previous owner, nil if unknown, e.g. for bounced transfers
+	To          string    // new owner
+	Direction   Direction // in if the account received the item, out if it sent it
+	Bounced     bool      // transfer request bounced back by the item, reverts the account's preceding out transfer of it
+	CryptoHash  string
+	CryptoTonLT uint64
+	EffectiveAt time.Time
+}
+
+// NFTOwnership is an NFT item the account received last and didn't send since.
+type NFTOwnership struct {
+	AccountID  int
+	Item       string
+	Collection *string
+	AcquiredLT uint64
+	AcquiredAt time.Time
+}
+
+// DEX is a decentralized exchange swaps are recognized for.
+type DEX string
+
+const (
+	DEXStonfi DEX = "stonfi"
+	DEXDedust DEX = "dedust"
+)
+
+// SwapSide tells whether swap leg is a request selling an asset or a payout buying one.
+type SwapSide string
+
+const (
+	SwapSideSell SwapSide = "sell"
+	SwapSideBuy  SwapSide = "buy"
+)
+
+// SwapLeg is a swap request sent or payout received by a tracked account.
+type SwapLeg struct {
+	ID          int
+	AccountID   int
+	DEX         DEX
+	Side        SwapSide
+	QueryID     uint64 // payouts keep query id of the request
+	AssetID     int
+	Jetton      *string // jetton master address, nil for TON
+	Amount      decimal.Decimal
+	Pool        *string // pool of the first swap step, nil for payouts or if unknown
+	CryptoHash  string
+	CryptoTonLT uint64
+	EffectiveAt time.Time
+}
+
+// Swap is a swap request grouped with its payout.
+type Swap struct {
+	AccountID     int
+	DEX           DEX
+	Pool          *string
+	SoldAssetID   int
+	SoldJetton    *string // nil for TON
+	SoldAmount    decimal.Decimal
+	BoughtAssetID int
+	BoughtJetton  *string // nil for TON
+	BoughtAmount  decimal.Decimal
+	SellHash      string
+	BuyHash       string
+	EffectiveAt   time.Time // time of the payout
+}
+
+// AssetBalance is a sum of stored amounts of one jetton, or of TON if Jetton is nil.
+type AssetBalance struct {
+	Jetton *string
+	Amount decimal.Decimal
+}
+
+// DailyBalance is a balance of an account in an asset at the end of the day.
+type DailyBalance struct {
+	Date    time.Time
+	Balance decimal.Decimal
+}
+
+// Discrepancy is a difference between stored and on-chain balance found by reconciliation.
+type Discrepancy struct {
+	ID        int
+	AccountID int
+	AssetID   int
+	Jetton    *string // jetton master address, nil for TON
+	Stored    decimal.Decimal
+	OnChain   decimal.Decimal
+	CheckedAt time.Time
+	Resynced  bool // whether full history of the account was enqueued to be synced again
+}
+
+// ChainGap is a transaction missing in stored history: some stored transaction refers to it as previous one.
+type ChainGap struct {
+	AccountID int
+	TxHash    string
+	TxLT      uint64
+}
+
+// RawTransaction is a serialized on-chain transaction kept to re-parse it later without fetching it again.
+type RawTransaction struct {
+	AccountID      int
+	CryptoHash     string
+	CryptoTonLT    uint64
+	BOC            []byte
+	BlockWorkchain int32
+	BlockShard     int64
+	BlockSeqno     uint32
+	BlockRootHash  string
+	BlockFileHash  string
 }
@@ -0,0 +1,167 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/nft"
+	"go.uber.org/zap"
+)
+
+// nftTransfer is an NFT movement found in a transaction of the owner.
+type nftTransfer struct {
+	item      *address.Address
+	from      *address.Address // nil if unknown
+	to        *address.Address
+	direction Direction
+	bounced   bool // transfer request bounced back by the item
+}
+
+// nftItem is an NFT item confirmed by its collection.
+type nftItem struct {
+	collection *string // nil for items outside of any collection
+}
+
+// nftResolver returns confirmed NFT item at the given address or nil if it's not an NFT item.
+type nftResolver func(item *address.Address) (*nftItem, error)
+
+// parseNFTOwnershipAssigned parses incoming ownership_assigned sent by the item to its new owner.
+func parseNFTOwnershipAssigned(msg *tlb.InternalMessage) (*nftTransfer, error) {
+	var a nftOwnershipAssigned
+	if err := tlb.LoadFromCell(&a, msg.Body.BeginParse()); err != nil {
+		return nil, fmt.Errorf("load ownership assigned: %w", err)
+	}
+
+	return &nftTransfer{item: msg.SrcAddr, from: a.PrevOwner, to: msg.DstAddr, direction: DirectionIn}, nil
+}
+
+// parseNFTTransfer parses outgoing transfer request sent by the owner to the item.
+func parseNFTTransfer(msg *tlb.InternalMessage) (*nftTransfer, error) {
+	var t nft.TransferPayload
+	if err := tlb.LoadFromCell(&t, msg.Body.BeginParse()); err != nil {
+		return nil, fmt.Errorf("load transfer: %w", err)
+	}
+
+	return &nftTransfer{item: msg.DstAddr, from: msg.SrcAddr, to: t.NewOwner, direction: DirectionOut}, nil
+}
+
+// parseNFTBounce parses transfer request bounced back by the item. It only returns the item to the sender
+// if the sender owned it, so the bounce reverts the sender's transfer request instead of being a transfer on its own.
+// Bounced body keeps only the beginning of the request, so the would-be owner is unknown.
+func parseNFTBounce(msg *tlb.InternalMessage) *nftTransfer {
+	slice := msg.Body.BeginParse()
+	if prefix, err := slice.LoadUInt(32); err != nil || prefix != opBounced {
+		return nil
+	}
+	if op, err := slice.LoadUInt(32); err != nil || op != opNFTTransfer {
+		return nil
+	}
+
+	return &nftTransfer{item: msg.SrcAddr, to: msg.DstAddr, direction: DirectionIn, bounced: true}
+}
+
+// castNFTTransfers returns NFT transfers of confirmed items found in transactions of the account.
+func castNFTTransfers(in []*parseTxResult, accountID int, resolveItem nftResolver) ([]NFTTransfer, error) {
+	var out []NFTTransfer
+	for _, parsed := range in {
+		tx := parsed.tx
+
+		for _, t := range parsed.nfts {
+			item, err := resolveItem(t.item)
+			if err != nil {
+				return nil, fmt.Errorf("resolve nft item: %w", err)
+			}
+			if item == nil {
+				continue
+			}
+
+			out = append(out, NFTTransfer{
+				AccountID:   accountID,
+				Item:        t.item.String(),
+				Collection:  item.collection,
+				From:        addrString(t.from),
+				To:          t.to.String(),
+				Direction:   t.direction,
+				Bounced:     t.bounced,
+				CryptoHash:  parsed.hash,
+				CryptoTonLT: tx.LT,
+				EffectiveAt: parsed.effectiveAt,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// resolveNFTItem checks that the address is an NFT item and returns its collection.
+// Collection is confirmed by asking it for the item address by index, so contracts pretending
+// to be an item of some collection are treated as not NFT items. Items outside of any collection
+// can't be confirmed, they are only trusted with Config.StandaloneNFTs.
+func (s *Syncer) resolveNFTItem(ctx context.Context, item *address.Address) (*nftItem, error) {
+	key := rawAddr(item)
+	if cached, ok := s.nftItems.Get(key); ok {
+		return cached, nil
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	res, err := s.ton.RunGetMethod(ctx, block, item, "get_nft_data")
+	var execErr ton.ContractExecError
+	if errors.As(err, &execErr) {
+		return s.notNFTItem(key, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run get_nft_data: %w", err)
+	}
+
+	// results that can't be parsed are skipped but not remembered, the next response may be fine
+	index, err := res.Int(1)
+	if err != nil {
+		s.logger.Debug("nft: failed to parse nft data", zap.String("address", key), zap.Error(err))
+		return nil, nil
+	}
+
+	collection, err := loadAddrResult(res, 2)
+	if err != nil {
+		s.logger.Debug("nft: failed to parse nft data", zap.String("address", key), zap.Error(err))
+		return nil, nil
+	}
+
+	if collection.Type() == address.NoneAddress {
+		if !s.cfg.StandaloneNFTs {
+			return s.notNFTItem(key, errors.New("item is outside of any collection"))
+		}
+		resolved := &nftItem{}
+		s.nftItems.Add(key, resolved)
+		return resolved, nil
+	}
+
+	expected, err := nft.NewCollectionClient(s.ton, collection).GetNFTAddressByIndexAtBlock(ctx, index, block)
+	if errors.As(err, &execErr) {
+		return s.notNFTItem(key, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get nft address by index: %w", err)
+	}
+	if rawAddr(expected) != key {
+		return s.notNFTItem(key, fmt.Errorf("collection %s doesn't confirm the item", collection))
+	}
+
+	resolved := &nftItem{collection: addrString(collection)}
+	s.nftItems.Add(key, resolved)
+	return resolved, nil
+}
+
+// notNFTItem remembers that address is not a confirmed NFT item.
+func (s *Syncer) notNFTItem(key string, reason error) (*nftItem, error) {
+	s.logger.Debug("nft: address is not an nft item", zap.String("address", key), zap.Error(reason))
+	s.nftItems.Add(key, nil)
+	return nil, nil
+}
@@ -0,0 +1,74 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+func TestCastNFTTransfersBounce(t *testing.T) {
+	owner := address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+	item := address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+	prevOwner := address.MustParseAddr("EQBfBWT7X2BHg9tXAxzhz2aKiNTU1tpt5NsiK0uSDW_YAJ67")
+
+	bouncedTransfer := cell.BeginCell().MustStoreUInt(opBounced, 32).MustStoreUInt(opNFTTransfer, 32).MustStoreUInt(7, 64).EndCell()
+	assigned := cell.BeginCell().
+		MustStoreUInt(opNFTOwnershipAssigned, 32).
+		MustStoreUInt(7, 64).
+		MustStoreAddr(prevOwner).
+		MustStoreBoolBit(false).
+		EndCell()
+
+	tests := []struct {
+		name    string
+		in      *tlb.InternalMessage
+		want    bool // whether a transfer is stored
+		bounced bool
+	}{
+		{
+			name:    "bounced transfer request",
+			in:      &tlb.InternalMessage{Bounced: true, SrcAddr: item, DstAddr: owner, Amount: tlb.MustFromTON("0.04"), Body: bouncedTransfer},
+			want:    true,
+			bounced: true,
+		},
+		{
+			name: "bounce prefix without bounced flag",
+			in:   &tlb.InternalMessage{SrcAddr: item, DstAddr: owner, Amount: tlb.MustFromTON("0.04"), Body: bouncedTransfer},
+		},
+		{
+			name: "ownership assigned",
+			in:   &tlb.InternalMessage{SrcAddr: item, DstAddr: owner, Amount: tlb.MustFromTON("0.01"), Body: assigned},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := testTx{account: owner, in: tt.in, description: ordinary()}.parse(t)
+			resolve := func(*address.Address) (*nftItem, error) { return &nftItem{}, nil }
+
+			transfers, err := castNFTTransfers([]*parseTxResult{parsed}, 1, resolve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want {
+				if len(transfers) != 0 {
+					t.Fatalf("stored transfers %+v", transfers)
+				}
+				return
+			}
+			if len(transfers) != 1 {
+				t.Fatalf("got %d transfers, want 1", len(transfers))
+			}
+
+			got := transfers[0]
+			if got.Direction != DirectionIn || got.Bounced != tt.bounced || got.Item != item.String() {
+				t.Fatalf("transfer = %+v, want incoming transfer of the item with bounced %v", got, tt.bounced)
+			}
+			if tt.bounced && got.From != nil {
+				t.Fatalf("bounced transfer has previous owner %s", *got.From)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sethvargo/go-envconfig"
+	"github.com/vgarvardt/gue/v5"
+	"github.com/xssnick/tonutils-go/ton"
+	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/pkg/cache"
+)
+
+var ErrMissingDependency = errors.New("syncer dependency is not provided")
+
+// Option configures Syncer in New.
+type Option func(*Syncer)
+
+// WithStorage sets storage the accounts and transactions are kept in. Required.
+func WithStorage(storage Storage) Option {
+	return func(s *Syncer) { s.storage = storage }
+}
+
+// WithQueue sets gue client used to enqueue and work updater jobs. Required to start syncing.
+func WithQueue(q *gue.Client) Option {
+	return func(s *Syncer) { s.q = q }
+}
+
+// WithTonAPI sets ton api client used to fetch accounts and transactions. Required to start syncing.
+func WithTonAPI(api ton.APIClientWrapped) Option {
+	return func(s *Syncer) { s.ton = api }
+}
+
+// WithConfirmers sets ton api clients of independent liteservers used to confirm responses when
+// Config.ConsensusNodes is set. There should be more of them than ConsensusNodes to tolerate failing nodes.
+func WithConfirmers(apis ...ton.APIClientWrapped) Option {
+	return func(s *Syncer) { s.confirmers = apis }
+}
+
+// WithDecoder registers decoder of message bodies with the given op code, replacing the built-in one if any.
+func WithDecoder(op uint32, d Decoder) Option {
+	return func(s *Syncer) { s.decoders[op] = d }
+}
+
+// WithSecrets sets provider of wallets' private keys used to decrypt encrypted comments.
+// Without it encrypted comments are stored with empty text.
+func WithSecrets(p SecretsProvider) Option {
+	return func(s *Syncer) { s.secrets = p }
+}
+
+// WithLogger sets logger, nop logger is used by default.
+func WithLogger(l *zap.Logger) Option {
+	return func(s *Syncer) { s.logger = l }
+}
+
+// WithConfig sets configuration, defaults from Config's env tags are used by default.
+func WithConfig(cfg Config) Option {
+	return func(s *Syncer) { s.cfg = cfg }
+}
+
+func New(opts ...Option) (*Syncer, error) {
+	s := &Syncer{
+		logger:        zap.NewNop(),
+		decoders:      defaultDecoders(),
+		jettonWallets: cache.NewLRU[string, *jettonAsset](jettonWalletsCacheSize),
+		masterSeqnos:  cache.NewLRU[string, *uint32](masterSeqnosCacheSize),
+		nftItems:      cache.NewLRU[string, *nftItem](nftItemsCacheSize),
+		masterShards:  cache.NewLRU[uint32, []*ton.BlockIDExt](masterShardsCacheSize),
+	}
+
+	// fill defaults from env tags without looking at the actual environment
+	if err := envconfig.ProcessWith(context.Background(), &s.cfg, envconfig.MapLookuper(nil)); err != nil {
+		return nil, fmt.Errorf("default config: %w", err)
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.storage == nil {
+		return nil, fmt.Errorf("%w: storage", ErrMissingDependency)
+	}
+
+	jettonAssets, err := parseJettonAssets(s.cfg.JettonAssets, s.cfg.JettonDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("jetton assets: %w", err)
+	}
+	s.jettonAssets = jettonAssets
+
+	return s, nil
+}
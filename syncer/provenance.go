@@ -0,0 +1,158 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/xssnick/tonutils-go/tl"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+	"go.uber.org/zap"
+)
+
+// maxCommitLookups limits how many masterchain blocks after the shard block's master reference
+// are checked to find the one that committed it.
+const maxCommitLookups = 16
+
+const masterchainShard = math.MinInt64 // 0x8000000000000000
+
+// setProvenance sets ids of blocks transactions were included in and seqnos of masterchain blocks committing them.
+func (s *Syncer) setProvenance(ctx context.Context, txs []Transaction, fetched []*fetchedTx) error {
+	blocks := make(map[string]*ton.BlockIDExt, len(fetched))
+	for _, f := range fetched {
+		blocks[txHashToString(f.tx.Hash)] = f.block
+	}
+
+	masterSeqnos := map[*ton.BlockIDExt]*uint32{} // rows of one transaction share the block
+	for i := range txs {
+		block, ok := blocks[*txs[i].CryptoHash]
+		if !ok {
+			continue
+		}
+
+		masterSeqno, ok := masterSeqnos[block]
+		if !ok {
+			var err error
+			masterSeqno, err = s.masterchainSeqno(ctx, block)
+			if err != nil {
+				return fmt.Errorf("find masterchain block of %d:%x:%d: %w", block.Workchain, uint64(block.Shard), block.SeqNo, err)
+			}
+			masterSeqnos[block] = masterSeqno
+		}
+
+		txs[i].BlockWorkchain = &block.Workchain
+		txs[i].BlockShard = &block.Shard
+		txs[i].BlockSeqno = &block.SeqNo
+		txs[i].MasterchainSeqno = masterSeqno
+	}
+
+	return nil
+}
+
+// masterchainSeqno returns seqno of the masterchain block which committed the given block
+// or nil if it is not found within maxCommitLookups blocks after the block's master reference.
+func (s *Syncer) masterchainSeqno(ctx context.Context, block *ton.BlockIDExt) (*uint32, error) {
+	if block.Workchain == -1 {
+		return &block.SeqNo, nil
+	}
+
+	key := fmt.Sprintf("%d:%d:%d", block.Workchain, block.Shard, block.SeqNo)
+	if cached, ok := s.masterSeqnos.Get(key); ok {
+		return cached, nil
+	}
+
+	ref, err := s.masterRef(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("get master ref: %w", err)
+	}
+
+	for seqno := ref + 1; seqno <= ref+maxCommitLookups; seqno++ {
+		shards, err := s.masterchainShards(ctx, seqno)
+		if errors.Is(err, ton.ErrBlockNotFound) {
+			break // not created yet, the shard block is too recent
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, shard := range shards {
+			if shard.Workchain == block.Workchain && shardsIntersect(shard.Shard, block.Shard) && shard.SeqNo >= block.SeqNo {
+				found := seqno
+				s.masterSeqnos.Add(key, &found)
+				return &found, nil
+			}
+		}
+	}
+
+	s.logger.Warn(
+		"provenance: masterchain block committing shard block is not found",
+		zap.Int32("workchain", block.Workchain),
+		zap.Uint32("seqno", block.SeqNo),
+		zap.Uint32("master_ref", ref),
+	)
+	return nil, nil
+}
+
+// masterchainShards returns top shard blocks committed by the masterchain block with the given seqno.
+// Shard blocks of one account are mostly committed by the same masterchain blocks, so they are cached.
+func (s *Syncer) masterchainShards(ctx context.Context, seqno uint32) ([]*ton.BlockIDExt, error) {
+	if cached, ok := s.masterShards.Get(seqno); ok {
+		return cached, nil
+	}
+
+	master, err := s.ton.LookupBlock(ctx, -1, masterchainShard, seqno)
+	if err != nil {
+		return nil, fmt.Errorf("lookup masterchain block %d: %w", seqno, err)
+	}
+
+	shards, err := s.ton.GetBlockShardsInfo(ctx, master)
+	if err != nil {
+		return nil, fmt.Errorf("get shards of masterchain block %d: %w", seqno, err)
+	}
+
+	s.masterShards.Add(seqno, shards)
+	return shards, nil
+}
+
+// masterRef returns seqno of the latest masterchain block known to the shard block, taken from its proven header.
+func (s *Syncer) masterRef(ctx context.Context, block *ton.BlockIDExt) (uint32, error) {
+	var resp tl.Serializable
+	err := s.ton.Client().QueryLiteserver(ctx, ton.LookupBlock{
+		Mode: 1,
+		ID:   &ton.BlockInfoShort{Workchain: block.Workchain, Shard: block.Shard, Seqno: int32(block.SeqNo)},
+	}, &resp)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := resp.(type) {
+	case ton.BlockHeader:
+		proof, err := cell.FromBOC(t.HeaderProof)
+		if err != nil {
+			return 0, fmt.Errorf("parse header proof: %w", err)
+		}
+
+		header, err := ton.CheckBlockProof(proof, block.RootHash)
+		if err != nil {
+			return 0, fmt.Errorf("check header proof: %w", err)
+		}
+		if header.BlockInfo.MasterRef == nil {
+			return 0, fmt.Errorf("shard block has no master ref")
+		}
+
+		return header.BlockInfo.MasterRef.SeqNo, nil
+	case ton.LSError:
+		return 0, t
+	}
+
+	return 0, fmt.Errorf("unexpected response %T", resp)
+}
+
+// shardsIntersect tells whether one shard is a prefix of another.
+func shardsIntersect(a, b int64) bool {
+	x, y := uint64(a), uint64(b)
+	z := max(x&-x, y&-y)
+	return (x^y)&((-z)<<1) == 0
+}
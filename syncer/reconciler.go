@@ -0,0 +1,289 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"go.uber.org/zap"
+
+	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+)
+
+// ErrAccountNotFound is returned when account to process is not among accounts having crypto address.
+var ErrAccountNotFound = errors.New("crypto account not found")
+
+// reconciler periodically reconciles all accounts until ctx is done.
+func (s *Syncer) reconciler(ctx context.Context) {
+	for range timeutils.TickWithCtx(ctx, s.cfg.ReconcileInterval) {
+		if _, err := s.Reconcile(ctx, 0, s.cfg.ReconcileResync); err != nil {
+			s.logger.Error("reconciler: failed", zap.Error(err))
+		}
+	}
+}
+
+// Reconcile compares stored balances of the account, or of every crypto account if accountID is 0,
+// with their on-chain TON and mapped jetton balances and stores found discrepancies.
+// If resync is true, full history of every account having discrepancies is enqueued to be synced again.
+// Accounts whose stored history is behind the chain are skipped.
+func (s *Syncer) Reconcile(ctx context.Context, accountID int, resync bool) ([]*Discrepancy, error) {
+	if s.ton == nil {
+		return nil, fmt.Errorf("%w: ton api", ErrMissingDependency)
+	}
+	if resync && s.q == nil {
+		return nil, fmt.Errorf("%w: queue", ErrMissingDependency)
+	}
+
+	accounts, err := s.storage.GetCryptoAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage get crypto accounts: %w", err)
+	}
+
+	var found []*Discrepancy
+	for _, account := range accounts {
+		if accountID != 0 && account.ID != accountID {
+			continue
+		}
+
+		dd, err := s.reconcileAccount(ctx, account, resync)
+		if err != nil {
+			return found, fmt.Errorf("reconcile account %d: %w", account.ID, err)
+		}
+		found = append(found, dd...)
+
+		if accountID != 0 {
+			return found, nil
+		}
+	}
+
+	if accountID != 0 {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+	}
+
+	return found, nil
+}
+
+func (s *Syncer) reconcileAccount(ctx context.Context, account *Account, resync bool) ([]*Discrepancy, error) {
+	addr, err := parseAnyAddr(*account.CryptoAddress)
+	if err != nil {
+		return nil, fmt.Errorf("parse addr: %w", err)
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	tonAcc, err := s.ton.GetAccount(ctx, block, addr)
+	if err != nil {
+		return nil, fmt.Errorf("ton get account: %w", err)
+	}
+
+	lastLT, err := s.storage.GetAccountLastTonLT(ctx, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("storage get account last ton lt: %w", err)
+	}
+	if lastLT != tonAcc.LastTxLT {
+		reconcilerAccounts.WithLabelValues(outcomeBehind).Inc()
+		s.logger.Debug(
+			"reconciler: stored history is behind the chain, skipping",
+			zap.Int("account_id", account.ID),
+			zap.Uint64("stored_lt", lastLT),
+			zap.Uint64("chain_lt", tonAcc.LastTxLT),
+		)
+		return nil, nil
+	}
+
+	balances, err := s.storage.GetAccountBalances(ctx, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("storage get account balances: %w", err)
+	}
+
+	stored := map[string]decimal.Decimal{} // by raw jetton master, empty for TON
+	for _, b := range balances {
+		key := ""
+		if b.Jetton != nil {
+			master, err := parseAnyAddr(*b.Jetton)
+			if err != nil {
+				return nil, fmt.Errorf("parse stored jetton %q: %w", *b.Jetton, err)
+			}
+			key = rawAddr(master)
+		}
+		stored[key] = stored[key].Add(b.Amount)
+	}
+
+	assetID := account.MainAssetID
+	if assetID == 0 {
+		assetID = s.cfg.AssetID
+	}
+
+	var found []*Discrepancy
+	if account.CryptoJetton != nil {
+		found, err = s.walletDiscrepancies(ctx, block, account, addr, stored)
+	} else {
+		found, err = s.accountDiscrepancies(ctx, block, account.ID, assetID, addr, tonAcc, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		reconcilerAccounts.WithLabelValues(outcomeReconciled).Inc()
+		return nil, nil
+	}
+	reconcilerAccounts.WithLabelValues(outcomeDiscrepancy).Inc()
+
+	if resync && tonAcc.State != nil {
+		if err := s.enqueue(ctx, jobArgs{
+			Addr:      tonAcc.State.Address.String(),
+			AccountID: account.ID,
+			AssetID:   assetID,
+			TxHash:    tonAcc.LastTxHash,
+			TxLT:      tonAcc.LastTxLT,
+			Force:     true,
+			Jetton:    account.CryptoJetton,
+		}); err != nil {
+			return nil, fmt.Errorf("enqueue resync: %w", err)
+		}
+		for _, d := range found {
+			d.Resynced = true
+		}
+	}
+
+	for _, d := range found {
+		s.logger.Warn(
+			"reconciler: stored balance differs from on-chain one",
+			zap.Int("account_id", d.AccountID),
+			zap.Int("asset_id", d.AssetID),
+			zap.Stringp("jetton", d.Jetton),
+			zap.String("stored", d.Stored.String()),
+			zap.String("on_chain", d.OnChain.String()),
+			zap.Bool("resynced", d.Resynced),
+		)
+	}
+
+	if err := s.storage.CreateDiscrepancies(ctx, found); err != nil {
+		return nil, fmt.Errorf("storage create discrepancies: %w", err)
+	}
+
+	return found, nil
+}
+
+// accountDiscrepancies compares stored TON and jetton balances of the account with on-chain ones.
+func (s *Syncer) accountDiscrepancies(
+	ctx context.Context,
+	block *ton.BlockIDExt,
+	accountID int,
+	assetID int,
+	addr *address.Address,
+	tonAcc *tlb.Account,
+	stored map[string]decimal.Decimal,
+) ([]*Discrepancy, error) {
+	onChain := decimal.Zero
+	if tonAcc.State != nil {
+		onChain = nanoToTON(tonAcc.State.Balance.Nano())
+	}
+
+	now := time.Now()
+	var found []*Discrepancy
+	if !stored[""].Equal(onChain) {
+		found = append(found, &Discrepancy{
+			AccountID: accountID,
+			AssetID:   assetID,
+			Stored:    stored[""],
+			OnChain:   onChain,
+			CheckedAt: now,
+		})
+	}
+
+	if s.cfg.JettonWallets { // jettons are stored and reconciled by child accounts of the wallets
+		return found, nil
+	}
+
+	for key, asset := range s.jettonAssets {
+		onChain, err := s.jettonBalance(ctx, block, asset, addr)
+		if err != nil {
+			return nil, fmt.Errorf("get %s balance: %w", asset.master, err)
+		}
+
+		if !stored[key].Equal(onChain) {
+			master := asset.master
+			found = append(found, &Discrepancy{
+				AccountID: accountID,
+				AssetID:   asset.assetID,
+				Jetton:    &master,
+				Stored:    stored[key],
+				OnChain:   onChain,
+				CheckedAt: now,
+			})
+		}
+	}
+
+	return found, nil
+}
+
+// walletDiscrepancies compares stored balance of the jetton wallet account with the wallet's own one.
+// TON the wallet holds is attached by its owner for fees and is not stored in the wallet account.
+func (s *Syncer) walletDiscrepancies(
+	ctx context.Context,
+	block *ton.BlockIDExt,
+	account *Account,
+	addr *address.Address,
+	stored map[string]decimal.Decimal,
+) ([]*Discrepancy, error) {
+	asset, err := s.walletJetton(*account.CryptoJetton)
+	if err != nil {
+		return nil, err
+	}
+
+	onChain, err := s.jettonWalletBalance(ctx, block, asset, addr)
+	if err != nil {
+		return nil, fmt.Errorf("get %s balance: %w", asset.master, err)
+	}
+
+	key := rawAddr(address.MustParseAddr(asset.master)) // master is formatted from a parsed address
+	if stored[key].Equal(onChain) {
+		return nil, nil
+	}
+
+	master := asset.master
+	return []*Discrepancy{{
+		AccountID: account.ID,
+		AssetID:   asset.assetID,
+		Jetton:    &master,
+		Stored:    stored[key],
+		OnChain:   onChain,
+		CheckedAt: time.Now(),
+	}}, nil
+}
+
+// jettonBalance returns owner's balance of the jetton, zero if owner has no wallet of it.
+func (s *Syncer) jettonBalance(
+	ctx context.Context,
+	block *ton.BlockIDExt,
+	asset *jettonAsset,
+	owner *address.Address,
+) (decimal.Decimal, error) {
+	master, err := address.ParseAddr(asset.master)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("parse master: %w", err)
+	}
+
+	wallet, err := jetton.NewJettonMasterClient(s.ton, master).GetJettonWalletAtBlock(ctx, owner, block)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("get jetton wallet: %w", err)
+	}
+
+	raw, err := wallet.GetBalanceAtBlock(ctx, block)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("get wallet balance: %w", err)
+	}
+
+	return asset.amount(raw), nil
+}
@@ -0,0 +1,280 @@
+package syncer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+	"go.uber.org/zap"
+)
+
+const reprocessBatchSize = 100
+
+// ReprocessResult tells how many rows reprocessing has created, corrected and deleted.
+type ReprocessResult struct {
+	Created int
+	Updated int
+	Deleted int
+}
+
+// Reprocess re-parses stored raw transactions of the given account, or of every crypto account if accountID is 0,
+// made at or after since and applies differences to stored rows: missing rows are created, parsed fields of
+// existing ones are corrected and rows no longer derived, like legacy fee rows, are deleted. Categories and merchants
+// are kept. Nothing is fetched from liteservers, so jetton rows are only derived for transactions already having one.
+// Ledger postings, NFT transfers and swap legs are not re-derived.
+func (s *Syncer) Reprocess(ctx context.Context, accountID int, since time.Time) (ReprocessResult, error) {
+	accounts, err := s.storage.GetCryptoAccounts(ctx)
+	if err != nil {
+		return ReprocessResult{}, fmt.Errorf("storage get crypto accounts: %w", err)
+	}
+
+	var total ReprocessResult
+	for _, account := range accounts {
+		if accountID != 0 && account.ID != accountID {
+			continue
+		}
+
+		res, err := s.reprocessAccount(ctx, account, since)
+		total.Created += res.Created
+		total.Updated += res.Updated
+		total.Deleted += res.Deleted
+		if err != nil {
+			return total, fmt.Errorf("reprocess account %d: %w", account.ID, err)
+		}
+		s.logger.Info(
+			"reprocess: account done",
+			zap.Int("account_id", account.ID),
+			zap.Int("created", res.Created),
+			zap.Int("updated", res.Updated),
+			zap.Int("deleted", res.Deleted),
+		)
+
+		if accountID != 0 {
+			return total, nil
+		}
+	}
+
+	if accountID != 0 {
+		return total, fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+	}
+
+	return total, nil
+}
+
+func (s *Syncer) reprocessAccount(ctx context.Context, account *Account, since time.Time) (ReprocessResult, error) {
+	var res ReprocessResult
+
+	tracked, err := s.getTrackedAccounts(ctx)
+	if err != nil {
+		return res, fmt.Errorf("get tracked accounts: %w", err)
+	}
+
+	assetID := account.MainAssetID
+	if assetID == 0 {
+		assetID = s.cfg.AssetID
+	}
+
+	key, err := s.privateKey(ctx, account.ID)
+	if err != nil {
+		return res, fmt.Errorf("get private key: %w", err)
+	}
+
+	var wallet *jettonAsset // jetton of jetton wallet accounts
+	if account.CryptoJetton != nil {
+		if wallet, err = s.walletJetton(*account.CryptoJetton); err != nil {
+			return res, fmt.Errorf("wallet jetton: %w", err)
+		}
+	}
+
+	var afterLT uint64
+	for {
+		raws, err := s.storage.GetRawTransactions(ctx, account.ID, afterLT, reprocessBatchSize)
+		if err != nil {
+			return res, fmt.Errorf("storage get raw transactions: %w", err)
+		}
+		if len(raws) == 0 {
+			return res, nil
+		}
+		afterLT = raws[len(raws)-1].CryptoTonLT
+
+		txs := make([]*parseTxResult, 0, len(raws))
+		hashes := make([]string, 0, len(raws))
+		byHash := make(map[string]*RawTransaction, len(raws))
+		for _, raw := range raws {
+			tx, root, err := loadRawTransaction(raw)
+			if err != nil {
+				return res, fmt.Errorf("load raw transaction %s: %w", raw.CryptoHash, err)
+			}
+			if time.Unix(int64(tx.Now), 0).Before(since) {
+				continue
+			}
+			parsed, err := parseTx(tx, root)
+			if err != nil {
+				return res, fmt.Errorf("parse raw transaction %s: %w", raw.CryptoHash, err)
+			}
+			txs = append(txs, parsed)
+			hashes = append(hashes, raw.CryptoHash)
+			byHash[raw.CryptoHash] = raw
+		}
+		if len(txs) == 0 {
+			continue
+		}
+
+		stored, err := s.storage.GetTransactionsByHashes(ctx, account.ID, hashes)
+		if err != nil {
+			return res, fmt.Errorf("storage get transactions by hashes: %w", err)
+		}
+
+		create, update, remove, err := s.diffDerived(txs, stored, account.ID, assetID, tracked, key, wallet)
+		if err != nil {
+			return res, err
+		}
+
+		for i := range create {
+			raw := byHash[*create[i].CryptoHash]
+			create[i].BlockWorkchain, create[i].BlockShard, create[i].BlockSeqno = &raw.BlockWorkchain, &raw.BlockShard, &raw.BlockSeqno
+			create[i].Status = s.statusAt(nil, 0) // pending until promoter finds its masterchain block
+		}
+
+		if err := s.categorize(ctx, account.ID, create); err != nil {
+			return res, fmt.Errorf("categorize: %w", err)
+		}
+
+		if err := s.storage.ApplyTransactionCorrections(ctx, create, update, remove); err != nil {
+			return res, fmt.Errorf("storage apply transaction corrections: %w", err)
+		}
+		res.Created += len(create)
+		res.Updated += len(update)
+		res.Deleted += len(remove)
+	}
+}
+
+// diffDerived casts transactions again and returns rows missing in stored ones, stored rows whose parsed fields differ
+// and stored rows of the transactions which are not derived anymore.
+func (s *Syncer) diffDerived(
+	txs []*parseTxResult,
+	stored []*Transaction,
+	accountID int,
+	assetID int,
+	tracked map[string]*Account,
+	key ed25519.PrivateKey,
+	wallet *jettonAsset,
+) (create []Transaction, update []Transaction, remove []Transaction, err error) {
+	byEntry := make(map[string]*Transaction, len(stored))
+	jettons := map[string]string{} // jetton master by transaction hash
+	for _, tx := range stored {
+		byEntry[*tx.CryptoHash+":"+string(tx.CryptoEntry)] = tx
+		if tx.CryptoJetton != nil {
+			jettons[*tx.CryptoHash] = *tx.CryptoJetton
+		}
+	}
+
+	for _, parsed := range txs {
+		hash := parsed.hash
+		resolveJetton := func(*address.Address) (*jettonAsset, error) {
+			master, ok := jettons[hash]
+			if !ok {
+				return nil, nil
+			}
+			addr, err := parseAnyAddr(master)
+			if err != nil {
+				return nil, fmt.Errorf("parse stored jetton %q: %w", master, err)
+			}
+			return s.jettonAssets[rawAddr(addr)], nil
+		}
+
+		var derived []Transaction
+		if wallet != nil {
+			derived, err = castWalletTransactions([]*parseTxResult{parsed}, accountID, wallet, s.decoders)
+		} else {
+			derived, err = castTransactions([]*parseTxResult{parsed}, accountID, assetID, s.cfg.FeeCategoryID, resolveJetton, tracked, s.decoders, key)
+			if err == nil && s.cfg.JettonWallets {
+				derived = withoutJettonRows(derived)
+			}
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cast transaction %s: %w", hash, err)
+		}
+
+		for _, d := range derived {
+			key := hash + ":" + string(d.CryptoEntry)
+			existing, ok := byEntry[key]
+			if !ok {
+				create = append(create, d)
+				continue
+			}
+			delete(byEntry, key)
+
+			d.ID = existing.ID
+			d.Internal = d.Internal || existing.Internal // might be linked after its counterparty became tracked
+			if parsedFieldsDiffer(existing, &d) {
+				update = append(update, d)
+			}
+		}
+	}
+
+	for _, tx := range stored {
+		if _, ok := byEntry[*tx.CryptoHash+":"+string(tx.CryptoEntry)]; ok {
+			remove = append(remove, *tx)
+		}
+	}
+
+	return create, update, remove, nil
+}
+
+// parsedFieldsDiffer compares fields derived from on-chain data, fields set by rules are not compared.
+func parsedFieldsDiffer(a, b *Transaction) bool {
+	return !a.Amount.Equal(b.Amount) ||
+		a.Comment != b.Comment ||
+		!a.EffectiveAt.Equal(b.EffectiveAt) ||
+		a.Internal != b.Internal ||
+		!equalPtr(a.CryptoCounterparty, b.CryptoCounterparty) ||
+		!equalPtr(a.CryptoOpCode, b.CryptoOpCode) ||
+		!equalPtr(a.CryptoJetton, b.CryptoJetton) ||
+		!equalPtr(a.CryptoMsgHash, b.CryptoMsgHash) ||
+		!equalPtr(a.CryptoPrevHash, b.CryptoPrevHash) ||
+		!equalPtr(a.CryptoPrevLT, b.CryptoPrevLT) ||
+		a.Kind != b.Kind ||
+		!sameJSON(a.Details, b.Details)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameJSON compares JSON documents by value, database may store them with other key order and spacing.
+func sameJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	var av, bv any
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func loadRawTransaction(raw *RawTransaction) (*tlb.Transaction, *cell.Cell, error) {
+	root, err := cell.FromBOC(raw.BOC)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse boc: %w", err)
+	}
+
+	var tx tlb.Transaction
+	if err := tlb.LoadFromCell(&tx, root.BeginParse()); err != nil {
+		return nil, nil, fmt.Errorf("load transaction from cell: %w", err)
+	}
+	tx.Hash = root.Hash()
+
+	return &tx, root, nil
+}
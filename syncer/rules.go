@@ -0,0 +1,199 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+const recategorizeBatchSize = 500
+
+// ruleSet is a list of rules ordered by priority with compiled comment regexps.
+type ruleSet struct {
+	rules   []*Rule
+	regexps []*regexp.Regexp
+}
+
+func compileRules(rules []*Rule) (*ruleSet, error) {
+	set := &ruleSet{rules: rules, regexps: make([]*regexp.Regexp, len(rules))}
+	for i, r := range rules {
+		if r.CommentRegexp == nil {
+			continue
+		}
+
+		re, err := regexp.Compile(*r.CommentRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("compile comment regexp of rule %d: %w", r.ID, err)
+		}
+		set.regexps[i] = re
+	}
+
+	return set, nil
+}
+
+// apply sets category and merchant label of the first matching rule, returns false if no rule matched.
+// Fee rows are never matched, they always have the fee category.
+func (set *ruleSet) apply(tx *Transaction) bool {
+	if tx.CryptoEntry.IsFee() {
+		return false
+	}
+
+	for i := range set.rules {
+		if !set.matches(i, tx) {
+			continue
+		}
+
+		r := set.rules[i]
+		tx.CategoryID = r.CategoryID
+		if r.MerchantLabel != nil {
+			tx.Merchant = *r.MerchantLabel
+		}
+		return true
+	}
+
+	return false
+}
+
+func (set *ruleSet) matches(i int, tx *Transaction) bool {
+	r := set.rules[i]
+
+	if r.Merchant != nil && (tx.CryptoCounterparty == nil || !sameAddr(*tx.CryptoCounterparty, *r.Merchant)) {
+		return false
+	}
+	if re := set.regexps[i]; re != nil && !re.MatchString(tx.Comment) {
+		return false
+	}
+	if r.MinAmount != nil && tx.Amount.Abs().LessThan(*r.MinAmount) {
+		return false
+	}
+	if r.MaxAmount != nil && tx.Amount.Abs().GreaterThan(*r.MaxAmount) {
+		return false
+	}
+	if r.Direction != nil && *r.Direction != direction(tx) {
+		return false
+	}
+	if r.Jetton != nil && (tx.CryptoJetton == nil || !sameAddr(*tx.CryptoJetton, *r.Jetton)) {
+		return false
+	}
+	if r.OpCode != nil && (tx.CryptoOpCode == nil || *tx.CryptoOpCode != *r.OpCode) {
+		return false
+	}
+
+	return true
+}
+
+// uncategorize resets category and merchant of the row to the ones it's inserted with when no rule matches.
+// Fee rows always keep the fee category.
+func uncategorize(tx *Transaction) {
+	if tx.CryptoEntry.IsFee() {
+		return
+	}
+
+	tx.CategoryID = 0
+	if tx.CryptoCounterparty != nil {
+		tx.Merchant = *tx.CryptoCounterparty
+	}
+}
+
+func direction(tx *Transaction) Direction {
+	if tx.Amount.IsNegative() {
+		return DirectionOut
+	}
+	return DirectionIn
+}
+
+// categorize applies account's rules to txs.
+func (s *Syncer) categorize(ctx context.Context, accountID int, txs []Transaction) error {
+	rules, err := s.storage.GetCategorizationRules(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("storage get categorization rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	set, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+
+	for i := range txs {
+		set.apply(&txs[i])
+	}
+
+	return nil
+}
+
+// Recategorize re-applies categorization rules to stored transactions of the given account
+// or of every account with crypto address if accountID is 0. It returns number of updated transactions.
+func (s *Syncer) Recategorize(ctx context.Context, accountID int) (int, error) {
+	accountIDs := []int{accountID}
+	if accountID == 0 {
+		accounts, err := s.storage.GetCryptoAccounts(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("storage get crypto accounts: %w", err)
+		}
+
+		accountIDs = make([]int, 0, len(accounts))
+		for _, a := range accounts {
+			accountIDs = append(accountIDs, a.ID)
+		}
+	}
+
+	var updated int
+	for _, id := range accountIDs {
+		n, err := s.recategorizeAccount(ctx, id)
+		updated += n
+		if err != nil {
+			return updated, fmt.Errorf("recategorize account %d: %w", id, err)
+		}
+		s.logger.Info("recategorize: account done", zap.Int("account_id", id), zap.Int("updated", n))
+	}
+
+	return updated, nil
+}
+
+func (s *Syncer) recategorizeAccount(ctx context.Context, accountID int) (int, error) {
+	rules, err := s.storage.GetCategorizationRules(ctx, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("storage get categorization rules: %w", err)
+	}
+
+	set, err := compileRules(rules)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated, afterID int
+	for {
+		txs, err := s.storage.GetAccountTransactions(ctx, accountID, afterID, recategorizeBatchSize)
+		if err != nil {
+			return updated, fmt.Errorf("storage get account transactions: %w", err)
+		}
+		if len(txs) == 0 {
+			return updated, nil
+		}
+
+		changed := make([]Transaction, 0, len(txs))
+		for _, tx := range txs {
+			categoryID, merchant := tx.CategoryID, tx.Merchant
+			if !set.apply(tx) {
+				uncategorize(tx) // rule that has categorized it before may be gone or changed
+			}
+			if tx.CategoryID != categoryID || tx.Merchant != merchant {
+				changed = append(changed, *tx)
+			}
+		}
+
+		if len(changed) > 0 {
+			if err := s.storage.UpdateTransactionsCategory(ctx, changed); err != nil {
+				return updated, fmt.Errorf("storage update transactions category: %w", err)
+			}
+			updated += len(changed)
+		}
+
+		afterID = txs[len(txs)-1].ID
+	}
+}
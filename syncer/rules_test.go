@@ -0,0 +1,98 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRuleSetApply(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	dec := func(s string) *decimal.Decimal { d := decimal.RequireFromString(s); return &d }
+	out, op := DirectionOut, uint32(opJettonTransfer)
+
+	merchant := "EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N"
+	merchantRaw := "0:83dfd552e63729b472fcbcc8c45ebcc6691702558b68ec7527e1ba403a0f31a8"
+	jetton := "EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs"
+
+	// ordered the way storage returns them: priority desc, user rules before global ones
+	rules := []*Rule{
+		{ID: 1, Priority: 10, Merchant: ptr(merchantRaw), Direction: &out, CategoryID: 1, MerchantLabel: ptr("Shop")},
+		{ID: 2, Priority: 10, CommentRegexp: ptr(`^invoice \d+$`), CategoryID: 2},
+		{ID: 3, Priority: 5, Jetton: ptr(jetton), OpCode: &op, CategoryID: 3},
+		{ID: 4, Priority: 1, MinAmount: dec("10"), MaxAmount: dec("100"), CategoryID: 4},
+	}
+	set, err := compileRules(rules)
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		tx           Transaction
+		wantCategory int
+		wantMerchant string
+	}{
+		{
+			name:         "merchant in other address form and direction",
+			tx:           Transaction{Amount: decimal.RequireFromString("-50"), CryptoCounterparty: &merchant, Merchant: merchant, Comment: "invoice 7"},
+			wantCategory: 1,
+			wantMerchant: "Shop",
+		},
+		{
+			name:         "first matching rule wins",
+			tx:           Transaction{Amount: decimal.RequireFromString("50"), CryptoCounterparty: &merchant, Merchant: merchant, Comment: "invoice 7"},
+			wantCategory: 2,
+			wantMerchant: merchant,
+		},
+		{
+			name:         "jetton and op code",
+			tx:           Transaction{Amount: decimal.RequireFromString("-1"), CryptoJetton: &jetton, CryptoOpCode: &op},
+			wantCategory: 3,
+		},
+		{
+			name:         "jetton without op code",
+			tx:           Transaction{Amount: decimal.RequireFromString("-1"), CryptoJetton: &jetton},
+			wantCategory: 0,
+		},
+		{
+			name:         "absolute amount bounds",
+			tx:           Transaction{Amount: decimal.RequireFromString("-100")},
+			wantCategory: 4,
+		},
+		{
+			name:         "above amount bounds",
+			tx:           Transaction{Amount: decimal.RequireFromString("100.5")},
+			wantCategory: 0,
+		},
+		{
+			name:         "fee rows are never matched",
+			tx:           Transaction{Amount: decimal.RequireFromString("-50"), CryptoEntry: EntryFeeCompute, CategoryID: 9},
+			wantCategory: 9,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := tc.tx
+			if tx.CryptoEntry == "" {
+				tx.CryptoEntry = EntryValue
+			}
+
+			matched := set.apply(&tx)
+			if matched != (tc.wantCategory != tc.tx.CategoryID) {
+				t.Errorf("got matched %t", matched)
+			}
+			if tx.CategoryID != tc.wantCategory || tx.Merchant != tc.wantMerchant {
+				t.Errorf("got category %d and merchant %q, want %d and %q", tx.CategoryID, tx.Merchant, tc.wantCategory, tc.wantMerchant)
+			}
+		})
+	}
+}
+
+func TestCompileRulesInvalidRegexp(t *testing.T) {
+	re := "("
+	if _, err := compileRules([]*Rule{{ID: 1, CommentRegexp: &re}}); err == nil {
+		t.Error("got no error for invalid comment regexp")
+	}
+}
@@ -0,0 +1,133 @@
+package syncer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+// codeHashWalletV5R1 is hex hash of wallet v5r1 code, tonutils doesn't know it yet.
+const codeHashWalletV5R1 = "20834b7b72b112147e1b2fb457b84e74d1a30f04f737d4f62a668e9552d2b72f"
+
+var walletInterfaces = map[wallet.Version]Interface{
+	wallet.V1R1:               InterfaceWalletV1,
+	wallet.V1R2:               InterfaceWalletV1,
+	wallet.V1R3:               InterfaceWalletV1,
+	wallet.V2R1:               InterfaceWalletV2,
+	wallet.V2R2:               InterfaceWalletV2,
+	wallet.V3R1:               InterfaceWalletV3R1,
+	wallet.V3R2:               InterfaceWalletV3R2,
+	wallet.V4R1:               InterfaceWalletV4R1,
+	wallet.V4R2:               InterfaceWalletV4R2,
+	wallet.HighloadV2R2:       InterfaceHighloadV2,
+	wallet.HighloadV2Verified: InterfaceHighloadV2,
+	wallet.Lockup:             InterfaceLockup,
+}
+
+// interfaceProbes are get methods telling apart contracts with unknown code, tried in order.
+var interfaceProbes = []struct {
+	method string
+	iface  Interface
+}{
+	{"get_wallet_data", InterfaceJettonWallet},
+	{"get_timeout", InterfaceHighloadV3},
+	{"is_signature_allowed", InterfaceWalletV5},
+}
+
+// recordAccountState stores snapshot of the account's on-chain state, tonAcc is nil if account doesn't exist.
+func (s *Syncer) recordAccountState(ctx context.Context, account *Account, tonAcc *tlb.Account) error {
+	state := AccountState{
+		AccountID: account.ID,
+		Status:    AccountStatusNonExist,
+		Balance:   decimal.Zero,
+		CheckedAt: time.Now(),
+	}
+
+	if tonAcc != nil && tonAcc.State != nil {
+		state.Status = accountStatus(tonAcc.State.Status)
+		state.Balance = nanoToTON(tonAcc.State.Balance.Nano())
+		state.LastTxLT = tonAcc.LastTxLT
+		if paid := tonAcc.State.StorageInfo.LastPaid; paid != 0 {
+			lastActivity := time.Unix(int64(paid), 0)
+			state.LastActivityAt = &lastActivity
+		}
+	}
+
+	if tonAcc != nil && tonAcc.Code != nil {
+		codeHash := hex.EncodeToString(tonAcc.Code.Hash())
+		state.CodeHash = &codeHash
+
+		iface, err := s.detectInterface(ctx, account, tonAcc)
+		if err != nil {
+			return fmt.Errorf("detect interface: %w", err)
+		}
+		state.Interface = iface
+	}
+
+	if err := s.storage.CreateAccountState(ctx, state); err != nil {
+		return fmt.Errorf("storage create account state: %w", err)
+	}
+
+	return nil
+}
+
+// detectInterface tells what the active contract is by its code. Contracts with unknown code are asked
+// for get methods of known interfaces, results are cached by code hash.
+func (s *Syncer) detectInterface(ctx context.Context, account *Account, tonAcc *tlb.Account) (Interface, error) {
+	if account.CryptoJetton != nil {
+		return InterfaceJettonWallet, nil
+	}
+	if iface, ok := walletInterfaces[wallet.GetWalletVersion(tonAcc)]; ok {
+		return iface, nil
+	}
+
+	codeHash := hex.EncodeToString(tonAcc.Code.Hash())
+	if codeHash == codeHashWalletV5R1 {
+		return InterfaceWalletV5, nil
+	}
+	if cached, ok := s.interfaces.Load(codeHash); ok {
+		return cached.(Interface), nil
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return "", fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	iface := InterfaceUnknown
+	for _, probe := range interfaceProbes {
+		_, err := s.ton.RunGetMethod(ctx, block, tonAcc.State.Address, probe.method)
+		var execErr ton.ContractExecError
+		if errors.As(err, &execErr) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("run %s: %w", probe.method, err)
+		}
+		iface = probe.iface
+		break
+	}
+
+	s.interfaces.Store(codeHash, iface)
+	return iface, nil
+}
+
+func accountStatus(status tlb.AccountStatus) AccountStatus {
+	switch status {
+	case tlb.AccountStatusActive:
+		return AccountStatusActive
+	case tlb.AccountStatusUninit:
+		return AccountStatusUninit
+	case tlb.AccountStatusFrozen:
+		return AccountStatusFrozen
+	default:
+		return AccountStatusNonExist
+	}
+}
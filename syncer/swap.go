@@ -0,0 +1,336 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+	"go.uber.org/zap"
+)
+
+const (
+	opStonfiSwap         = 0x25938561 // forward payload of jetton transfer to STON.fi router
+	opDedustSwap         = 0xe3a0d482 // forward payload of jetton transfer to DeDust jetton vault
+	opDedustNativeSwap   = 0xea06185d // TON sent to DeDust native vault
+	opDedustNativePayout = 0x474f86cf // TON paid out by DeDust native vault
+)
+
+var (
+	stonfiRouter      = address.MustParseAddr("EQB3ncyBUTjZUA5EnFKR5_EnOMI9V1tTEAAPaiU71gc4TiUt")
+	stonfiPTONWallet  = address.MustParseAddr("EQARULUYsmJq1RiZ-YiH-IJLcAZUVkVff-KBPwEmmaQGH6aC") // router's proxy TON wallet
+	dedustNativeVault = address.MustParseAddr("EQDa4VOnTYlLvDJ0gZjNYm5PXfSmmtL6Vs6A_CZEtXCNICq_")
+	dedustFactory     = address.MustParseAddr("EQBfBWT7X2BHg9tXAxzhz2aKiNTU1tpt5NsiK0uSDW_YAJ67")
+)
+
+// swapLeg is a DEX swap request or payout found in a transaction of the trader.
+type swapLeg struct {
+	dex         DEX // empty for jetton payouts until their sender is confirmed to be a DeDust vault
+	side        SwapSide
+	queryID     uint64
+	wallet      *address.Address // trader's jetton wallet, nil for TON
+	amount      *big.Int         // positive amount in jetton's minimal units or nanotons
+	sender      *address.Address // contract the payout comes from
+	pool        *address.Address // pool of the first swap step if known
+	offerWallet *address.Address // STON.fi router's wallet of the sold jetton if known
+	askWallet   *address.Address // STON.fi router's wallet of the bought jetton
+	vault       *address.Address // DeDust vault the jetton is sent to, checked to be the vault of the jetton
+}
+
+// swapResolver confirms the leg with get methods of DEX contracts and fills its DEX and pool,
+// it returns false if the leg turned out not to be a swap leg.
+type swapResolver func(leg *swapLeg, asset *jettonAsset) (bool, error)
+
+// parseSwapRequest parses outgoing swap request, nil if the message is not one.
+func parseSwapRequest(msg *tlb.InternalMessage, op uint32) *swapLeg {
+	switch op {
+	case opJettonTransfer:
+		var t jetton.TransferPayload
+		if err := tlb.LoadFromCell(&t, msg.Body.BeginParse()); err != nil || t.ForwardPayload == nil {
+			return nil
+		}
+
+		payload := t.ForwardPayload.BeginParse()
+		payloadOp, err := payload.LoadUInt(32)
+		if err != nil {
+			return nil
+		}
+
+		leg := &swapLeg{side: SwapSideSell, queryID: t.QueryID, wallet: msg.DstAddr, amount: t.Amount.Nano()}
+		switch {
+		case payloadOp == opStonfiSwap && isAddr(t.Destination, stonfiRouter):
+			if leg.askWallet, err = payload.LoadAddr(); err != nil {
+				return nil
+			}
+			leg.dex = DEXStonfi
+			if isAddr(msg.DstAddr, stonfiPTONWallet) { // TON is sent as proxy TON right to the router's wallet
+				leg.wallet, leg.offerWallet = nil, msg.DstAddr
+			}
+		case payloadOp == opDedustSwap:
+			if leg.pool, err = payload.LoadAddr(); err != nil {
+				return nil
+			}
+			leg.dex, leg.vault = DEXDedust, t.Destination
+		default:
+			return nil
+		}
+		return leg
+	case opDedustNativeSwap:
+		if !isAddr(msg.DstAddr, dedustNativeVault) {
+			return nil
+		}
+
+		slice := msg.Body.BeginParse()
+		_, _ = slice.LoadUInt(32)
+		queryID, err := slice.LoadUInt(64)
+		if err != nil {
+			return nil
+		}
+		amount, err := slice.LoadBigCoins()
+		if err != nil {
+			return nil
+		}
+		pool, err := slice.LoadAddr()
+		if err != nil {
+			return nil
+		}
+		return &swapLeg{dex: DEXDedust, side: SwapSideSell, queryID: queryID, amount: amount, pool: pool}
+	}
+
+	return nil
+}
+
+// parseSwapPayout parses incoming swap payout, nil if the message can't be one.
+// Jetton payouts of unknown senders are returned without DEX to be checked against DeDust vaults.
+func parseSwapPayout(msg *tlb.InternalMessage, op *uint32) *swapLeg {
+	if msg.Bounced {
+		return nil
+	}
+
+	if op != nil && *op == opJettonTransferNotification {
+		var n jettonTransferNotification
+		if err := tlb.LoadFromCell(&n, msg.Body.BeginParse()); err != nil {
+			return nil
+		}
+
+		leg := &swapLeg{side: SwapSideBuy, queryID: n.QueryID, wallet: msg.SrcAddr, amount: n.Amount.Nano(), sender: n.Sender}
+		if isAddr(n.Sender, stonfiRouter) {
+			leg.dex = DEXStonfi
+		}
+		return leg
+	}
+
+	var dex DEX
+	switch {
+	case isAddr(msg.SrcAddr, dedustNativeVault) && op != nil && *op == opDedustNativePayout:
+		dex = DEXDedust
+	case isAddr(msg.SrcAddr, stonfiPTONWallet) && (op == nil || *op != opExcesses):
+		dex = DEXStonfi
+	default:
+		return nil
+	}
+
+	var queryID uint64
+	if msg.Body != nil {
+		slice := msg.Body.BeginParse()
+		if _, err := slice.LoadUInt(32); err == nil {
+			queryID, _ = slice.LoadUInt(64)
+		}
+	}
+	return &swapLeg{dex: dex, side: SwapSideBuy, queryID: queryID, amount: msg.Amount.Nano(), sender: msg.SrcAddr}
+}
+
+// castSwapLegs returns swap legs of mapped assets found in transactions of the trader.
+func castSwapLegs(
+	in []*parseTxResult,
+	accountID int,
+	assetID int,
+	resolveJetton jettonResolver,
+	resolveSwap swapResolver,
+) ([]SwapLeg, error) {
+	var out []SwapLeg
+	for _, parsed := range in {
+		tx := parsed.tx
+
+		for _, leg := range parsed.swaps {
+			var asset *jettonAsset
+			if leg.wallet != nil {
+				var err error
+				if asset, err = resolveJetton(leg.wallet); err != nil {
+					return nil, fmt.Errorf("resolve jetton: %w", err)
+				}
+				if asset == nil {
+					continue
+				}
+			}
+
+			ok, err := resolveSwap(&leg, asset)
+			if err != nil {
+				return nil, fmt.Errorf("resolve swap: %w", err)
+			}
+			if !ok {
+				continue
+			}
+
+			row := SwapLeg{
+				AccountID:   accountID,
+				DEX:         leg.dex,
+				Side:        leg.side,
+				QueryID:     leg.queryID,
+				AssetID:     assetID,
+				Amount:      nanoToTON(leg.amount),
+				Pool:        addrString(leg.pool),
+				CryptoHash:  parsed.hash,
+				CryptoTonLT: tx.LT,
+				EffectiveAt: parsed.effectiveAt,
+			}
+			if asset != nil {
+				row.AssetID, row.Jetton, row.Amount = asset.assetID, &asset.master, asset.amount(leg.amount)
+			}
+			out = append(out, row)
+		}
+	}
+
+	return out, nil
+}
+
+// resolveSwap confirms that jetton payouts of unknown senders come from DeDust vaults of the jetton
+// and jetton sell requests to DeDust go to the vault of the jetton, and finds pools of STON.fi swap requests.
+func (s *Syncer) resolveSwap(ctx context.Context, leg *swapLeg, asset *jettonAsset) (bool, error) {
+	switch {
+	case leg.side == SwapSideBuy && leg.dex == "":
+		vault, err := s.dedustVault(ctx, asset)
+		if err != nil {
+			return false, fmt.Errorf("dedust vault: %w", err)
+		}
+		if vault == nil || !isAddr(vault, leg.sender) {
+			return false, nil
+		}
+		leg.dex = DEXDedust
+	case leg.side == SwapSideSell && leg.dex == DEXDedust && leg.vault != nil:
+		vault, err := s.dedustVault(ctx, asset)
+		if err != nil {
+			return false, fmt.Errorf("dedust vault: %w", err)
+		}
+		if vault == nil || !isAddr(vault, leg.vault) {
+			return false, nil
+		}
+	case leg.side == SwapSideSell && leg.dex == DEXStonfi:
+		pool, err := s.stonfiPool(ctx, leg, asset)
+		if err != nil {
+			return false, fmt.Errorf("stonfi pool: %w", err)
+		}
+		leg.pool = pool
+	}
+
+	return true, nil
+}
+
+// dedustVault returns address of DeDust vault of the jetton, nil if there is no vault.
+func (s *Syncer) dedustVault(ctx context.Context, asset *jettonAsset) (*address.Address, error) {
+	if cached, ok := s.dexAddrs.Load("dedust:" + asset.master); ok {
+		return cached.(*address.Address), nil
+	}
+
+	master, err := address.ParseAddr(asset.master)
+	if err != nil {
+		return nil, fmt.Errorf("parse master: %w", err)
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	// asset is jetton$0001 workchain_id:int8 address:uint256
+	dedustAsset := cell.BeginCell().
+		MustStoreUInt(1, 4).
+		MustStoreInt(int64(master.Workchain()), 8).
+		MustStoreSlice(master.Data(), 256).
+		EndCell().BeginParse()
+
+	vault, err := s.dexAddrResult(ctx, block, dedustFactory, "get_vault_address", dedustAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	s.dexAddrs.Store("dedust:"+asset.master, vault)
+	return vault, nil
+}
+
+// stonfiPool returns address of STON.fi pool the swap request goes to, nil if the router doesn't know it.
+func (s *Syncer) stonfiPool(ctx context.Context, leg *swapLeg, asset *jettonAsset) (*address.Address, error) {
+	offer := "ton"
+	if leg.offerWallet == nil {
+		offer = asset.master
+	}
+	key := "stonfi:" + offer + ":" + rawAddr(leg.askWallet)
+	if cached, ok := s.dexAddrs.Load(key); ok {
+		return cached.(*address.Address), nil
+	}
+
+	block, err := s.ton.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ton current masterchain info: %w", err)
+	}
+
+	offerWallet := leg.offerWallet
+	if offerWallet == nil {
+		master, err := address.ParseAddr(asset.master)
+		if err != nil {
+			return nil, fmt.Errorf("parse master: %w", err)
+		}
+		wallet, err := jetton.NewJettonMasterClient(s.ton, master).GetJettonWalletAtBlock(ctx, stonfiRouter, block)
+		if err != nil {
+			return nil, fmt.Errorf("get router wallet: %w", err)
+		}
+		offerWallet = wallet.Address()
+	}
+
+	pool, err := s.dexAddrResult(ctx, block, stonfiRouter, "get_pool_address", addrSlice(offerWallet), addrSlice(leg.askWallet))
+	if err != nil {
+		return nil, err
+	}
+
+	s.dexAddrs.Store(key, pool)
+	return pool, nil
+}
+
+// dexAddrResult runs get method of DEX contract returning an address, nil if the contract refuses to answer.
+func (s *Syncer) dexAddrResult(
+	ctx context.Context,
+	block *ton.BlockIDExt,
+	contract *address.Address,
+	method string,
+	params ...any,
+) (*address.Address, error) {
+	res, err := s.ton.RunGetMethod(ctx, block, contract, method, params...)
+	var execErr ton.ContractExecError
+	if errors.As(err, &execErr) {
+		s.logger.Debug("swap: dex contract refused to answer", zap.String("method", method), zap.Error(err))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %w", method, err)
+	}
+
+	addr, err := loadAddrResult(res, 0)
+	if err != nil {
+		return nil, fmt.Errorf("load %s result: %w", method, err)
+	}
+	return addr, nil
+}
+
+func addrSlice(addr *address.Address) *cell.Slice {
+	return cell.BeginCell().MustStoreAddr(addr).EndCell().BeginParse()
+}
+
+// isAddr tells whether both addresses are the same standard address.
+func isAddr(a, b *address.Address) bool {
+	return a != nil && b != nil && a.Type() == address.StdAddress && b.Type() == address.StdAddress && rawAddr(a) == rawAddr(b)
+}
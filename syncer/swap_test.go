@@ -0,0 +1,113 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+func TestParseSwapLegs(t *testing.T) {
+	var (
+		trader       = address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+		traderWallet = address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+		askWallet    = address.MustParseAddr("EQBfBWT7X2BHg9tXAxzhz2aKiNTU1tpt5NsiK0uSDW_YAJ67")
+		dedustVault  = address.MustParseAddr("EQAYqo4u7VF0fa4DPAebk4g9lBytj2VFny7pzXR0trjtXQaO")
+		dedustPool   = address.MustParseAddr("EQA-X_yo3fzzbDbJ_0bzFWKqtRuZFIRa1sJsveZJ1YpViO3r")
+	)
+
+	stonfiSwap := mustBody(t, &jetton.TransferPayload{
+		QueryID:             11,
+		Amount:              tlb.MustFromTON("1"),
+		Destination:         stonfiRouter,
+		ResponseDestination: trader,
+		ForwardTONAmount:    tlb.MustFromTON("0.2"),
+		ForwardPayload: cell.BeginCell().
+			MustStoreUInt(opStonfiSwap, 32).
+			MustStoreAddr(askWallet).
+			MustStoreCoins(1).
+			MustStoreAddr(trader).
+			EndCell(),
+	})
+	dedustSwap := mustBody(t, &jetton.TransferPayload{
+		QueryID:             12,
+		Amount:              tlb.FromNanoTONU(700),
+		Destination:         dedustVault,
+		ResponseDestination: trader,
+		ForwardTONAmount:    tlb.MustFromTON("0.25"),
+		ForwardPayload: cell.BeginCell().
+			MustStoreUInt(opDedustSwap, 32).
+			MustStoreAddr(dedustPool).
+			EndCell(),
+	})
+	nativePayout := cell.BeginCell().MustStoreUInt(opDedustNativePayout, 32).MustStoreUInt(13, 64).EndCell()
+
+	tests := []struct {
+		name string
+		tx   testTx
+		want swapLeg
+	}{
+		{
+			name: "stonfi jetton sell",
+			tx: testTx{out: []*tlb.InternalMessage{
+				{SrcAddr: trader, DstAddr: traderWallet, Amount: tlb.MustFromTON("0.3"), Body: stonfiSwap},
+			}},
+			want: swapLeg{dex: DEXStonfi, side: SwapSideSell, queryID: 11, wallet: traderWallet, amount: tlb.MustFromTON("1").Nano(), askWallet: askWallet},
+		},
+		{
+			name: "stonfi pton sell",
+			tx: testTx{out: []*tlb.InternalMessage{
+				{SrcAddr: trader, DstAddr: stonfiPTONWallet, Amount: tlb.MustFromTON("1.3"), Body: stonfiSwap},
+			}},
+			want: swapLeg{dex: DEXStonfi, side: SwapSideSell, queryID: 11, amount: tlb.MustFromTON("1").Nano(), offerWallet: stonfiPTONWallet, askWallet: askWallet},
+		},
+		{
+			name: "dedust jetton sell",
+			tx: testTx{out: []*tlb.InternalMessage{
+				{SrcAddr: trader, DstAddr: traderWallet, Amount: tlb.MustFromTON("0.3"), Body: dedustSwap},
+			}},
+			want: swapLeg{dex: DEXDedust, side: SwapSideSell, queryID: 12, wallet: traderWallet, amount: tlb.FromNanoTONU(700).Nano(), pool: dedustPool, vault: dedustVault},
+		},
+		{
+			name: "dedust native payout",
+			tx: testTx{
+				in: &tlb.InternalMessage{SrcAddr: dedustNativeVault, DstAddr: trader, Amount: tlb.MustFromTON("2.5"), Body: nativePayout},
+			},
+			want: swapLeg{dex: DEXDedust, side: SwapSideBuy, queryID: 13, amount: tlb.MustFromTON("2.5").Nano(), sender: dedustNativeVault},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.tx.account, tc.tx.totalFees, tc.tx.description = trader, tlb.FromNanoTONU(1_000), ordinary()
+
+			parsed := tc.tx.parse(t)
+			if len(parsed.swaps) != 1 {
+				t.Fatalf("got %d swap legs, want 1", len(parsed.swaps))
+			}
+
+			got := parsed.swaps[0]
+			if got.dex != tc.want.dex || got.side != tc.want.side || got.queryID != tc.want.queryID || got.amount.Cmp(tc.want.amount) != 0 {
+				t.Errorf("got %s %s leg %d of %s, want %s %s leg %d of %s",
+					got.dex, got.side, got.queryID, got.amount, tc.want.dex, tc.want.side, tc.want.queryID, tc.want.amount)
+			}
+			for _, a := range []struct {
+				field     string
+				got, want *address.Address
+			}{
+				{"wallet", got.wallet, tc.want.wallet},
+				{"sender", got.sender, tc.want.sender},
+				{"pool", got.pool, tc.want.pool},
+				{"offer wallet", got.offerWallet, tc.want.offerWallet},
+				{"ask wallet", got.askWallet, tc.want.askWallet},
+				{"vault", got.vault, tc.want.vault},
+			} {
+				if (a.got == nil) != (a.want == nil) || (a.want != nil && !isAddr(a.got, a.want)) {
+					t.Errorf("got %s %v, want %v", a.field, a.got, a.want)
+				}
+			}
+		})
+	}
+}
@@ -4,27 +4,73 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sourcegraph/conc"
+	"github.com/sourcegraph/conc/panics"
 	"github.com/sourcegraph/conc/pool"
 	"github.com/vgarvardt/gue/v5"
 	adapter "github.com/vgarvardt/gue/v5/adapter/zap"
-	"github.com/xssnick/tonutils-go/address"
-	"github.com/xssnick/tonutils-go/liteclient"
 	"github.com/xssnick/tonutils-go/ton"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/pkg/cache"
+	timeutils "github.com/eqtlab/ton-syncer/pkg/time"
+)
+
+// jettonWalletsCacheSize bounds number of resolved jetton wallets kept in memory, every counterparty has its own.
+const jettonWalletsCacheSize = 100_000
+
+// masterSeqnosCacheSize bounds number of shard blocks whose committing masterchain block is kept in memory,
+// masterShardsCacheSize bounds number of masterchain blocks whose shards are kept, consecutive shard blocks
+// are committed by the same few masterchain blocks.
+const (
+	masterSeqnosCacheSize = 100_000
+	nftItemsCacheSize     = 100_000
+	masterShardsCacheSize = 1024
 )
 
+var tracer = otel.Tracer("github.com/eqtlab/ton-syncer/syncer")
+
 // Syncer keeps accounts in sync by polling ton api and inserting missing transactions into the storage
 type Syncer struct {
 	cfg     Config
 	storage Storage
 	q       *gue.Client
-	ton     *ton.APIClient
-	tonpool *liteclient.ConnectionPool
+	ton     ton.APIClientWrapped
 	logger  *zap.Logger
+
+	confirmers    []ton.APIClientWrapped // independent liteservers confirming responses of ton
+	nextConfirmer atomic.Uint32
+
+	jettonAssets  map[string]*jettonAsset          // by raw master address
+	jettonWallets *cache.LRU[string, *jettonAsset] // by raw jetton wallet address, nil if jetton is not mapped
+	nftItems      *cache.LRU[string, *nftItem]     // raw nft item address -> item, nil if it's not a confirmed item
+	dexAddrs      sync.Map                         // DeDust vault by jetton and STON.fi pool by router wallets -> *address.Address, nil if there is none
+
+	jettonWalletAccounts sync.Map // "<owner account id>:<jetton master>" of wallets already stored as accounts
+	interfaces           sync.Map // hex code hash -> Interface of contracts with code unknown to tonutils
+	tracked              trackedAccounts
+	decoders             Decoders // by op code
+	secrets              SecretsProvider
+	masterSeqnos         *cache.LRU[string, *uint32]           // "workchain:shard:seqno" of a shard block -> seqno of masterchain block committing it
+	masterShards         *cache.LRU[uint32, []*ton.BlockIDExt] // seqno of a masterchain block -> top shard blocks it commits
+
+	progress progress
+	stopping <-chan struct{} // closed when Sync's context is done
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{} // not nil while syncer is running
+	exited chan error    // receives error of the run started with Start once it exits
+	err    error
 }
 
 type Storage interface {
@@ -36,78 +82,250 @@ type Storage interface {
 	SetAccountEndSynсTime(ctx context.Context, accountID int, syncTime time.Time) error
 	// CreateTonTransactions inserts transactions into storage
 	CreateTonTransactions(context.Context, []Transaction) error
+	// GetQueueStats returns number of queued jobs of the given type and creation time of the oldest one
+	GetQueueStats(ctx context.Context, jobType string) (*QueueStats, error)
+	// GetQueuedJobHashes returns transaction hashes queued jobs of the given type fetch the account's history from
+	GetQueuedJobHashes(ctx context.Context, jobType string, accountID int) ([]string, error)
+	// GetCategorizationRules returns rules of account's user and global rules ordered by priority
+	GetCategorizationRules(ctx context.Context, accountID int) ([]*Rule, error)
+	// GetCryptoAccounts returns all accounts having crypto address
+	GetCryptoAccounts(ctx context.Context) ([]*Account, error)
+	// GetAccountTransactions returns up to limit account's transactions with id greater than afterID ordered by id
+	GetAccountTransactions(ctx context.Context, accountID int, afterID int, limit int) ([]*Transaction, error)
+	// UpdateTransactionsCategory sets category and merchant of the given transactions by their ids
+	UpdateTransactionsCategory(ctx context.Context, txs []Transaction) error
+	// CreateLedgerPostings inserts ledger postings skipping already existing ones and deletes external postings of the same entries they replace
+	CreateLedgerPostings(ctx context.Context, postings []Posting) error
+	// CreateJettonWalletAccounts inserts jetton wallet accounts skipping ones already existing for the same owner and jetton
+	CreateJettonWalletAccounts(ctx context.Context, accounts []Account) error
+	// CreateAccountState inserts snapshot of account's on-chain state unless it's the same as the latest stored one
+	CreateAccountState(ctx context.Context, state AccountState) error
+	// CreateNFTTransfers inserts NFT transfers skipping already existing ones
+	CreateNFTTransfers(ctx context.Context, transfers []NFTTransfer) error
+	// CreateSwapLegs inserts DEX swap requests and payouts skipping already existing ones
+	CreateSwapLegs(ctx context.Context, legs []SwapLeg) error
+	// LinkInternalTransfers marks value or jetton rows having one of the given hashes of messages between tracked accounts as internal
+	LinkInternalTransfers(ctx context.Context, msgHashes []string) error
+	// GetAccountLastTonLT returns the greatest logical time of account's stored transactions, 0 if there are none
+	GetAccountLastTonLT(ctx context.Context, accountID int) (uint64, error)
+	// GetAccountBalances returns sums of account's stored on-chain amounts by jetton
+	GetAccountBalances(ctx context.Context, accountID int) ([]*AssetBalance, error)
+	// GetChainGaps returns transactions referred as previous by account's stored transactions but not stored themselves
+	GetChainGaps(ctx context.Context, accountID int) ([]*ChainGap, error)
+	// CreateRawTransactions inserts raw transactions skipping already existing ones
+	CreateRawTransactions(ctx context.Context, txs []RawTransaction) error
+	// GetRawTransactions returns up to limit account's raw transactions with logical time greater than afterLT ordered by it
+	GetRawTransactions(ctx context.Context, accountID int, afterLT uint64, limit int) ([]*RawTransaction, error)
+	// GetTransactionsByHashes returns all rows of account's transactions with the given hashes
+	GetTransactionsByHashes(ctx context.Context, accountID int, cryptoHashes []string) ([]*Transaction, error)
+	// ApplyTransactionCorrections inserts missing rows, updates parsed fields of existing ones and deletes rows
+	// no longer derived in one db transaction
+	ApplyTransactionCorrections(ctx context.Context, create []Transaction, update []Transaction, remove []Transaction) error
+	// ConfirmTransactions marks pending rows committed at or before the given masterchain block as confirmed
+	ConfirmTransactions(ctx context.Context, maxMasterchainSeqno uint32) (int, error)
+	// GetUnanchoredTransactions returns up to limit pending rows with id greater than afterID ordered by id
+	// having block but no masterchain block committing it
+	GetUnanchoredTransactions(ctx context.Context, afterID int, limit int) ([]*Transaction, error)
+	// SetTransactionsMasterchainSeqno sets masterchain seqno of the given rows by their ids
+	SetTransactionsMasterchainSeqno(ctx context.Context, txs []Transaction) error
+	// CreateDiscrepancies inserts reconciliation discrepancies
+	CreateDiscrepancies(ctx context.Context, discrepancies []*Discrepancy) error
 }
 
-func New(
-	s Storage,
-	q *gue.Client,
-	t *ton.APIClient,
-	tonpool *liteclient.ConnectionPool,
-	l *zap.Logger,
-	cfg Config,
-) *Syncer {
-	return &Syncer{
-		storage: s,
-		q:       q,
-		ton:     t,
-		tonpool: tonpool,
-		logger:  l,
-		cfg:     cfg,
+const queueType = "update"
+
+var (
+	ErrAlreadyStarted = errors.New("syncer is already started")
+	ErrNotStarted     = errors.New("syncer is not started")
+
+	ErrStoppedUnexpectedly = errors.New("syncer has stopped without an error while it's not canceled")
+)
+
+// Sync runs the synchronization and blocks until ctx is canceled or updaters fail.
+// After ctx is canceled actualizers stop right away while updater jobs
+// in progress get ShutdownTimeout to finish before their context is canceled too.
+func (s *Syncer) Sync(ctx context.Context) error {
+	done, err := s.start(ctx)
+	if err != nil {
+		return err
 	}
+
+	<-done
+	return s.finish(done)
 }
 
-const queueType = "update"
+// Start runs the synchronization in background, use Stop to shut it down.
+func (s *Syncer) Start(ctx context.Context) error {
+	_, err := s.start(ctx)
+	return err
+}
 
-// Sync panics if it can't initialize worker queue
-func (s *Syncer) Sync(ctx context.Context) {
-	newCtx, cancel := context.WithCancel(ctx)
+// Done returns channel receiving the error the synchronization started with Start exits with, nil error
+// if it exits because of Stop or ctx cancelation. Only one receiver gets the error, the channel is closed after it.
+// Returned channel is nil if synchronization is not started.
+func (s *Syncer) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	actualizers := pool.New().WithMaxGoroutines(s.cfg.WorkerPoolSize)
-	for i := 0; i < s.cfg.WorkerPoolSize; i++ {
-		actualizers.Go(func() { s.actualizer(newCtx) })
+	return s.exited
+}
+
+// Stop cancels the synchronization started with Start and waits until it's shut down or ctx is done.
+// It returns the error synchronization has failed with if any.
+func (s *Syncer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if done == nil {
+		return ErrNotStarted
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return s.finish(done)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// start builds updaters pool and runs actualizers and updaters in background. Returned chan is closed once they exit.
+func (s *Syncer) start(ctx context.Context) (<-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		return nil, ErrAlreadyStarted
 	}
 
+	switch {
+	case s.q == nil:
+		return nil, fmt.Errorf("%w: queue", ErrMissingDependency)
+	case s.ton == nil:
+		return nil, fmt.Errorf("%w: ton api", ErrMissingDependency)
+	case s.cfg.ConsensusNodes > len(s.confirmers):
+		return nil, fmt.Errorf("%w: %d confirmers", ErrMissingDependency, s.cfg.ConsensusNodes)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// in-flight jobs don't see ctx cancelation right away, they have ShutdownTimeout to finish
+	jobsCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		<-ctx.Done()
+		timeutils.SleepWithCtx(jobsCtx, s.cfg.ShutdownTimeout)
+		cancelJobs()
+	}()
+
 	updaters, err := gue.NewWorkerPool(
 		s.q,
 		gue.WorkMap{queueType: s.updater},
 		s.cfg.WorkerPoolSize,
 		gue.WithPoolLogger(adapter.New(s.logger)),
+		gue.WithPoolGracefulShutdown(func() context.Context { return jobsCtx }),
 	)
 	if err != nil {
-		s.logger.Fatal("gue new worker pool", zap.Error(err))
+		cancelJobs()
+		cancel()
+		return nil, fmt.Errorf("gue new worker pool: %w", err)
 	}
 
+	done, exited := make(chan struct{}), make(chan error, 1)
+	s.cancel, s.done, s.exited, s.err = cancel, done, exited, nil
+	s.progress.reset(time.Now())
+	s.stopping = ctx.Done()
+
+	go func() {
+		defer close(done)
+		defer cancelJobs()
+		defer cancel()
+
+		runCtx, cancelRun := context.WithCancel(ctx) // canceled by the run itself as soon as one of its parts exits
+		defer cancelRun()
+
+		var pc panics.Catcher
+		pc.Try(func() { s.err = s.run(runCtx, cancelRun, updaters) })
+		if r := pc.Recovered(); r != nil {
+			s.err = r.AsError()
+		}
+		if s.err == nil && ctx.Err() == nil {
+			s.err = ErrStoppedUnexpectedly
+		}
+
+		exited <- s.err
+		close(exited)
+	}()
+
 	s.logger.Info("syncer has started")
 
-	// run actualizers and updaters concurrently and cancel ctx as soon one of them exit so another exit too
+	return done, nil
+}
+
+// finish resets state of the run that has closed done and returns its error.
+func (s *Syncer) finish(done <-chan struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	if s.done == done {
+		s.cancel, s.done, s.exited = nil, nil, nil
+	}
+
+	return err
+}
+
+// run runs actualizers and updaters concurrently and cancels ctx as soon one of them exit so another exit too.
+func (s *Syncer) run(ctx context.Context, cancel context.CancelFunc, updaters *gue.WorkerPool) error {
+	actualizers := pool.New().WithMaxGoroutines(s.cfg.WorkerPoolSize)
+	for i := 0; i < s.cfg.WorkerPoolSize; i++ {
+		id := i
+		actualizers.Go(func() { s.actualizer(ctx, id) })
+	}
+
+	var updatersErr error
 	var wg conc.WaitGroup
 	wg.Go(func() {
 		defer cancel()
 		actualizers.Wait()
 	})
+	wg.Go(func() { s.queueMonitor(ctx) })
+	if s.cfg.ReconcileInterval > 0 {
+		wg.Go(func() { s.reconciler(ctx) })
+	}
+	if s.cfg.ConfirmationDepth > 0 {
+		wg.Go(func() { s.promoter(ctx) })
+	}
+	if s.cfg.ChainVerifyInterval > 0 {
+		wg.Go(func() { s.chainVerifier(ctx) })
+	}
 	wg.Go(func() {
 		defer cancel()
-		if err := updaters.Run(newCtx); err != nil {
-			s.logger.Fatal("updaters run", zap.Error(err))
+		if err := updaters.Run(ctx); err != nil {
+			updatersErr = fmt.Errorf("updaters run: %w", err)
 		}
 	})
 	wg.Wait()
+
+	s.logger.Info("syncer has stopped")
+
+	return updatersErr
 }
 
 type jobArgs struct {
-	Addr      string `json:"addr"` // we don't store address.Address because of it's not-marshallable private fields
-	AccountID int    `json:"accountId"`
-	TxHash    []byte `json:"TxHash"`
-	TxLT      uint64 `json:"txLt"`
+	Addr      string            `json:"addr"` // we don't store address.Address because of it's not-marshallable private fields
+	AccountID int               `json:"accountId"`
+	AssetID   int               `json:"assetId,omitempty"` // asset for TON amounts, zero means Config.AssetID
+	TxHash    []byte            `json:"TxHash"`
+	TxLT      uint64            `json:"txLt"`
+	Force     bool              `json:"force,omitempty"`  // don't stop at already stored transactions, walk the whole history
+	Jetton    *string           `json:"jetton,omitempty"` // jetton master if the account is a jetton wallet
+	Trace     map[string]string `json:"trace,omitempty"`  // trace context of the enqueuer so the whole backfill chain is one trace
 }
 
-func (s *Syncer) enqueue(ctx context.Context, addr *address.Address, accountID int, hash []byte, lt uint64) error {
-	args := jobArgs{
-		Addr:      addr.String(),
-		AccountID: accountID,
-		TxHash:    hash,
-		TxLT:      lt,
-	}
+func (s *Syncer) enqueue(ctx context.Context, args jobArgs) error {
+	args.Trace = map[string]string{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(args.Trace))
 
 	bb, err := json.Marshal(&args)
 	if err != nil {
@@ -127,10 +345,28 @@ func txHashToString(bb []byte) string {
 
 // nolint:lll
 type Config struct {
-	WorkerPoolSize        int           `env:"WORKER_POOL_SIZE, default=1"`          // How many actualizers and updaters to spawn
-	AccountsCheckInterval time.Duration `env:"ACCOUNTS_CHECK_INTERVAL, default=10s"` // How long one actualizer wait before new account lookup
-	ActualizerStartDelay  time.Duration `env:"ACTUALIZER_START_DELAY, default=1s"`   // How much time to wait before spawn next actualizer in a pool
-	AccountSyncInterval   time.Duration `env:"ACCOUNT_SYNC_INTERVAL, default=10m"`   // How frequently each account must be synced
-	UpdaterLock           time.Duration `env:"UPDATER_LOCK_TIMEOUT, default=10s"`    // How much time updater have to process one account
-	AssetID int `env:"UPDATER_ASSET_ID, default=0"`    // AssetID that updater will use when inserting new transactions into the storage
+	WorkerPoolSize        int             `env:"WORKER_POOL_SIZE, default=1"`            // How many actualizers and updaters to spawn
+	AccountsCheckInterval time.Duration   `env:"ACCOUNTS_CHECK_INTERVAL, default=10s"`   // How long one actualizer wait before new account lookup
+	ActualizerStartDelay  time.Duration   `env:"ACTUALIZER_START_DELAY, default=1s"`     // How much time to wait before spawn next actualizer in a pool
+	AccountSyncInterval   time.Duration   `env:"ACCOUNT_SYNC_INTERVAL, default=10m"`     // How frequently each account must be synced
+	UpdaterLock           time.Duration   `env:"UPDATER_LOCK_TIMEOUT, default=10s"`      // How much time updater have to process one account
+	AssetID               int             `env:"UPDATER_ASSET_ID, default=0"`            // AssetID that updater will use for accounts without main asset
+	JettonAssets          map[string]int  `env:"UPDATER_JETTON_ASSETS, separator=="`     // Jetton master address to asset id, e.g. "EQ...=2,EQ...=3"; transfers of other jettons are skipped
+	JettonDecimals        map[string]int  `env:"UPDATER_JETTON_DECIMALS, separator=="`   // Jetton master address to its decimals, 9 by default
+	FeeCategoryID         int             `env:"UPDATER_FEE_CATEGORY_ID, default=0"`     // CategoryID of fee rows, categorization rules are not applied to them
+	Ledger                bool            `env:"UPDATER_LEDGER, default=false"`          // Whether to also write balanced ledger postings of every transaction
+	StoreRaw              bool            `env:"UPDATER_STORE_RAW, default=false"`       // Whether to also store serialized transactions to re-parse them later
+	JettonWallets         bool            `env:"UPDATER_JETTON_WALLETS, default=false"`  // Whether to discover wallets of mapped jettons of tracked accounts and sync them as child accounts
+	StandaloneNFTs        bool            `env:"UPDATER_STANDALONE_NFTS, default=false"` // Whether to store transfers of NFT items outside of any collection, they can't be confirmed
+	AccountStates         bool            `env:"ACCOUNT_STATES, default=false"`          // Whether to store status, code, detected interface and balance of accounts every time they're synced
+	VerifyProofs          bool            `env:"VERIFY_PROOFS, default=false"`           // Whether to verify inclusion proofs of fetched transactions, ton api must validate masterchain blocks too
+	ConsensusNodes        int             `env:"CONSENSUS_NODES, default=0"`             // How many other liteservers must confirm last transactions and fetched pages, 0 disables consensus
+	ConsensusMinAmount    decimal.Decimal `env:"CONSENSUS_MIN_AMOUNT, default=0"`        // Pages are confirmed only if they have an absolute value or jetton amount at least this, 0 confirms every page
+	ConfirmationDepth     uint32          `env:"CONFIRMATION_DEPTH, default=0"`          // How many masterchain blocks must follow the committing one before rows are confirmed, 0 confirms right away
+	HealthProgressWindow  time.Duration   `env:"HEALTH_PROGRESS_WINDOW, default=5m"`     // How long actualizers may make no progress and updater jobs may run before syncer is considered unhealthy
+	HealthMaxHeadAge      time.Duration   `env:"HEALTH_MAX_HEAD_AGE, default=1m"`        // How long masterchain head may stay the same before liteserver is considered stale
+	ShutdownTimeout       time.Duration   `env:"SHUTDOWN_TIMEOUT, default=30s"`          // How long updater jobs in progress may run after shutdown was requested
+	ReconcileInterval     time.Duration   `env:"RECONCILE_INTERVAL, default=0"`          // How frequently to reconcile stored balances with on-chain ones, 0 disables reconciliation
+	ReconcileResync       bool            `env:"RECONCILE_RESYNC, default=false"`        // Whether to resync full history of accounts having discrepancies
+	ChainVerifyInterval   time.Duration   `env:"CHAIN_VERIFY_INTERVAL, default=0"`       // How frequently to look for and repair gaps in stored history, 0 disables verification
 }
@@ -0,0 +1,45 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// trackedAccounts caches accounts having crypto address by their raw address, jetton wallet accounts are left out.
+// It is refreshed at most once per AccountsCheckInterval.
+type trackedAccounts struct {
+	mu       sync.Mutex
+	byAddr   map[string]*Account
+	loadedAt time.Time
+}
+
+func (s *Syncer) getTrackedAccounts(ctx context.Context) (map[string]*Account, error) {
+	s.tracked.mu.Lock()
+	defer s.tracked.mu.Unlock()
+
+	if s.tracked.byAddr != nil && time.Since(s.tracked.loadedAt) < s.cfg.AccountsCheckInterval {
+		return s.tracked.byAddr, nil
+	}
+
+	accounts, err := s.storage.GetCryptoAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage get crypto accounts: %w", err)
+	}
+
+	byAddr := make(map[string]*Account, len(accounts))
+	for _, a := range accounts {
+		if a.ParentAccountID != nil {
+			continue // jetton wallets are contracts of tracked accounts, not their counterparties
+		}
+		addr, err := parseAnyAddr(*a.CryptoAddress)
+		if err != nil {
+			continue // such account can't be synced anyway
+		}
+		byAddr[rawAddr(addr)] = a
+	}
+
+	s.tracked.byAddr, s.tracked.loadedAt = byAddr, time.Now()
+	return byAddr, nil
+}
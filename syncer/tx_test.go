@@ -0,0 +1,115 @@
+package syncer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// testTx describes a transaction to be serialized the way liteservers return it.
+type testTx struct {
+	account     *address.Address
+	in          *tlb.InternalMessage
+	out         []*tlb.InternalMessage
+	totalFees   tlb.Coins
+	description any // one of tlb transaction descriptions
+}
+
+// boc serializes the transaction, tlb can load transactions but not store them.
+func (tt testTx) boc(t *testing.T) []byte {
+	t.Helper()
+
+	io := cell.BeginCell()
+	if tt.in != nil {
+		io.MustStoreMaybeRef(mustMsgCell(t, tt.in))
+	} else {
+		io.MustStoreMaybeRef(nil)
+	}
+	out := cell.NewDict(15)
+	for i, msg := range tt.out {
+		if err := out.SetIntKey(big.NewInt(int64(i)), cell.BeginCell().MustStoreRef(mustMsgCell(t, msg)).EndCell()); err != nil {
+			t.Fatalf("set out message %d: %v", i, err)
+		}
+	}
+	io.MustStoreDict(out)
+
+	status, err := tlb.AccountStatus(tlb.AccountStatusActive).ToCell()
+	if err != nil {
+		t.Fatalf("status to cell: %v", err)
+	}
+	fees, err := tlb.ToCell(&tlb.CurrencyCollection{Coins: tt.totalFees})
+	if err != nil {
+		t.Fatalf("fees to cell: %v", err)
+	}
+	update, err := tlb.ToCell(&tlb.HashUpdate{OldHash: make([]byte, 32), NewHash: make([]byte, 32)})
+	if err != nil {
+		t.Fatalf("hash update to cell: %v", err)
+	}
+	desc, err := tlb.ToCell(tt.description)
+	if err != nil {
+		t.Fatalf("description to cell: %v", err)
+	}
+
+	return cell.BeginCell().
+		MustStoreUInt(0b0111, 4).
+		MustStoreSlice(tt.account.Data(), 256).
+		MustStoreUInt(1000, 64).
+		MustStoreSlice(make([]byte, 32), 256).
+		MustStoreUInt(0, 64).
+		MustStoreUInt(1700000000, 32).
+		MustStoreUInt(uint64(len(tt.out)), 15).
+		MustStoreBuilder(status.ToBuilder()).
+		MustStoreBuilder(status.ToBuilder()).
+		MustStoreRef(io.EndCell()).
+		MustStoreBuilder(fees.ToBuilder()).
+		MustStoreRef(update).
+		MustStoreRef(desc).
+		EndCell().ToBOC()
+}
+
+// parse loads the transaction back from its boc and parses it.
+func (tt testTx) parse(t *testing.T) *parseTxResult {
+	t.Helper()
+
+	tx, root, err := loadRawTransaction(&RawTransaction{BOC: tt.boc(t)})
+	if err != nil {
+		t.Fatalf("load transaction: %v", err)
+	}
+	parsed, err := parseTx(tx, root)
+	if err != nil {
+		t.Fatalf("parse transaction: %v", err)
+	}
+	return parsed
+}
+
+func mustMsgCell(t *testing.T, msg *tlb.InternalMessage) *cell.Cell {
+	t.Helper()
+
+	c, err := msg.ToCell()
+	if err != nil {
+		t.Fatalf("message to cell: %v", err)
+	}
+	return c
+}
+
+// ordinary is a description of a successful ordinary transaction with skipped compute phase.
+func ordinary() tlb.TransactionDescriptionOrdinary {
+	return tlb.TransactionDescriptionOrdinary{
+		ComputePhase: tlb.ComputePhase{Phase: tlb.ComputePhaseSkipped{
+			Reason: tlb.ComputeSkipReason{Type: tlb.ComputeSkipReasonNoState},
+		}},
+	}
+}
+
+func mustBody(t *testing.T, v any) *cell.Cell {
+	t.Helper()
+
+	c, err := tlb.ToCell(v)
+	if err != nil {
+		t.Fatalf("body to cell: %v", err)
+	}
+	return c
+}
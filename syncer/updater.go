@@ -2,15 +2,24 @@ package syncer
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/vgarvardt/gue/v5"
 	"github.com/xssnick/tonutils-go/address"
 	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"github.com/eqtlab/ton-syncer/pkg/tracing"
 )
 
 func (s *Syncer) updater(ctx context.Context, job *gue.Job) (err error) {
@@ -19,10 +28,15 @@ func (s *Syncer) updater(ctx context.Context, job *gue.Job) (err error) {
 		return fmt.Errorf("json unmarshal: %w", jsonErr)
 	}
 
+	attempt := s.progress.startUpdate(time.Now())
 	defer func() {
+		s.progress.finishUpdate(attempt, time.Now()) // failed attempts are progress too, the retry delay is not part of them
 		if err != nil {
 			s.logger.Error("updater: job failed, going to retry after timeout", zap.Error(err), zap.Any("job_args", args))
-			time.Sleep(time.Hour)
+			select {
+			case <-time.After(time.Hour):
+			case <-s.stopping: // don't hold shutdown
+			}
 			return
 		}
 		if setTimeErr := s.storage.SetAccountEndSynсTime(ctx, args.AccountID, time.Now()); setTimeErr != nil {
@@ -34,13 +48,29 @@ func (s *Syncer) updater(ctx context.Context, job *gue.Job) (err error) {
 		}
 	}()
 
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(args.Trace))
+	ctx, span := tracer.Start(ctx, "updater.job", trace.WithAttributes(
+		attribute.Int("account.id", args.AccountID),
+		attribute.Int64("ton.tx_lt", int64(args.TxLT)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	start, outcome := time.Now(), outcomeSynced
+	defer func() { // registered after the retry delay above so the delay is not observed
+		if err != nil {
+			outcome = outcomeError
+		}
+		updaterJobDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	}()
+
 	// sometimes we need to stop pagination because cursor intersects already stored history
 	hashString := txHashToString(args.TxHash)
 	ok, err := s.storage.IsExistingCryptoTransaction(ctx, args.AccountID, hashString)
 	if err != nil {
 		return fmt.Errorf("check transaction existence for account: %w", err)
 	}
-	if ok {
+	if ok && !args.Force {
+		outcome = outcomeUpToDate
 		s.logger.Debug(
 			"updater: account is up to date",
 			zap.Int("account_id", args.AccountID),
@@ -54,30 +84,129 @@ func (s *Syncer) updater(ctx context.Context, job *gue.Job) (err error) {
 		return fmt.Errorf("parse addr: %w", err)
 	}
 
-	ctx = s.tonpool.StickyContext(ctx) // fetch all transactions from single node
-	allFetchedTxs, err := s.ton.ListTransactions(ctx, addr, uint32(100), args.TxLT, args.TxHash)
+	ctx = s.ton.Client().StickyContext(ctx) // fetch all transactions from single node
+	fetched, err := s.listTransactions(ctx, addr, uint32(100), args.TxLT, args.TxHash)
 	if err != nil {
 		return fmt.Errorf("ton list transactions: %w", err)
 	}
+	allFetchedTxs := transactionsOf(fetched)
+	parsed, err := parseTxs(fetched)
+	if err != nil {
+		return err
+	}
 
-	casted, err := castTransactions(allFetchedTxs, args.AccountID, s.cfg.AssetID)
+	assetID := args.AssetID
+	if assetID == 0 {
+		assetID = s.cfg.AssetID // jobs enqueued before asset was part of arguments
+	}
+
+	tracked, err := s.getTrackedAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("get tracked accounts: %w", err)
+	}
+
+	key, err := s.privateKey(ctx, args.AccountID)
+	if err != nil {
+		return fmt.Errorf("get private key: %w", err)
+	}
+
+	resolveJetton := func(wallet *address.Address) (*jettonAsset, error) { return s.resolveJetton(ctx, wallet) }
+	var casted []Transaction
+	if args.Jetton != nil {
+		var asset *jettonAsset
+		if asset, err = s.walletJetton(*args.Jetton); err != nil {
+			return fmt.Errorf("wallet jetton: %w", err)
+		}
+		casted, err = castWalletTransactions(parsed, args.AccountID, asset, s.decoders)
+	} else {
+		casted, err = castTransactions(parsed, args.AccountID, assetID, s.cfg.FeeCategoryID, resolveJetton, tracked, s.decoders, key)
+	}
 	if err != nil {
 		return fmt.Errorf("cast transactions: %w", err)
 	}
 
+	// page is confirmed before anything is written or enqueued for it
+	if s.needsConsensus(casted) {
+		if err = s.confirm(ctx, addr, args.TxLT, args.TxHash, txHashes(allFetchedTxs)); err != nil {
+			return fmt.Errorf("confirm page: %w", err)
+		}
+	}
+
+	if s.cfg.JettonWallets && args.Jetton == nil {
+		if owner, ok := tracked[rawAddr(addr)]; ok {
+			assets, err := s.observedJettons(casted)
+			if err != nil {
+				return fmt.Errorf("observed jettons: %w", err)
+			}
+			// wallets are only an addition to the owner's history, so failing to find them doesn't stop its sync
+			if discoverErr := s.discoverJettonWallets(ctx, owner, assets); discoverErr != nil {
+				s.logger.Warn("updater: failed to discover jetton wallets", zap.Error(discoverErr), zap.Int("account_id", owner.ID))
+			}
+		}
+		casted = withoutJettonRows(casted) // child accounts of the wallets store jetton movements
+	}
+
+	if err = s.categorize(ctx, args.AccountID, casted); err != nil {
+		return fmt.Errorf("categorize: %w", err)
+	}
+
+	if err = s.setProvenance(ctx, casted, fetched); err != nil {
+		return fmt.Errorf("set provenance: %w", err)
+	}
+
+	if err = s.setStatus(ctx, casted); err != nil {
+		return fmt.Errorf("set status: %w", err)
+	}
+
+	// raw transactions and postings go first: they are idempotent while rows stop the retry as soon as they exist
+	if s.cfg.StoreRaw {
+		if err = s.storage.CreateRawTransactions(ctx, castRawTransactions(fetched, args.AccountID)); err != nil {
+			return fmt.Errorf("insert raw transactions: %w", err)
+		}
+	}
+
+	if s.cfg.Ledger && args.Jetton == nil { // owner's transactions post jetton movements of its wallets
+		if err = s.postLedger(ctx, parsed, args.AccountID, assetID, resolveJetton, tracked); err != nil {
+			return fmt.Errorf("post ledger: %w", err)
+		}
+	}
+
+	resolveItem := func(item *address.Address) (*nftItem, error) { return s.resolveNFTItem(ctx, item) }
+	nfts, err := castNFTTransfers(parsed, args.AccountID, resolveItem)
+	if err != nil {
+		return fmt.Errorf("cast nft transfers: %w", err)
+	}
+	if err = s.storage.CreateNFTTransfers(ctx, nfts); err != nil {
+		return fmt.Errorf("insert nft transfers: %w", err)
+	}
+
+	if args.Jetton == nil { // swaps are requested and paid out through the owner
+		resolveSwap := func(leg *swapLeg, asset *jettonAsset) (bool, error) { return s.resolveSwap(ctx, leg, asset) }
+		legs, err := castSwapLegs(parsed, args.AccountID, assetID, resolveJetton, resolveSwap)
+		if err != nil {
+			return fmt.Errorf("cast swap legs: %w", err)
+		}
+		if err = s.storage.CreateSwapLegs(ctx, legs); err != nil {
+			return fmt.Errorf("insert swap legs: %w", err)
+		}
+	}
+
 	if err = s.storage.CreateTonTransactions(ctx, casted); err != nil {
 		return fmt.Errorf("insert transaction: %w", err)
 	}
+	updaterTransactionsInserted.Add(float64(len(casted)))
+
+	// counterpart rows of already synced tracked accounts are marked too, even if they were stored before tracking
+	if err = s.storage.LinkInternalTransfers(ctx, internalMsgHashes(parsed, casted, tracked, args.AccountID)); err != nil {
+		return fmt.Errorf("link internal transfers: %w", err)
+	}
 
 	oldestFetchedTx := allFetchedTxs[0]
 	if oldestFetchedTx.PrevTxLT != 0 {
-		if enqueueErr := s.enqueue( // it's important to enqueue only if everything else is ok to avoid infinite loop
-			ctx,
-			addr,
-			args.AccountID,
-			oldestFetchedTx.PrevTxHash,
-			oldestFetchedTx.PrevTxLT,
-		); enqueueErr != nil {
+		next := args
+		next.TxHash, next.TxLT = oldestFetchedTx.PrevTxHash, oldestFetchedTx.PrevTxLT
+		// it's important to enqueue only if everything else is ok to avoid infinite loop
+		if enqueueErr := s.enqueue(ctx, next); enqueueErr != nil {
 			return fmt.Errorf("enqueue: %w", enqueueErr)
 		}
 	}
@@ -85,71 +214,148 @@ func (s *Syncer) updater(ctx context.Context, job *gue.Job) (err error) {
 	return nil
 }
 
-func castTransactions(in []*tlb.Transaction, accountID int, assetID int) (out []Transaction, err error) {
+func castTransactions(
+	in []*parseTxResult,
+	accountID int,
+	assetID int,
+	feeCategoryID int,
+	resolveJetton jettonResolver,
+	tracked map[string]*Account,
+	decoders Decoders,
+	key ed25519.PrivateKey,
+) (out []Transaction, err error) {
 	out = make([]Transaction, 0, len(in))
 
 	// reverse order from older to newer to from newer to older to make ids order clear
 	for i := len(in) - 1; i >= 0; i-- {
-		tx := in[i]
+		parsed := in[i]
+		tx := parsed.tx
 
-		parsed, err := parseTx(tx)
-		if err != nil {
-			return nil, fmt.Errorf("parse transaction: %w", err)
+		kind, details := decoders.decode(parsed.body)
+		if kind == KindEncryptedComment {
+			if text, ok := decryptComment(parsed.body, parsed.sender, key); ok {
+				parsed.desc = text
+			}
+		}
+
+		isInternal := func(counterparty *address.Address) bool {
+			return isTrackedCounterparty(tracked, accountID, counterparty)
 		}
 
 		withoutFee := Transaction{
-			AccountID:   accountID,
-			Merchant:    parsed.merchant,
-			Amount:      parsed.amount,
-			Comment:     parsed.desc,
-			CryptoHash:  &parsed.hash,
-			CryptoTonLT: &tx.LT,
-			EffectiveAt: parsed.effectiveAt,
-			AssetID:     assetID,
+			AccountID:          accountID,
+			Merchant:           parsed.merchant,
+			Amount:             parsed.amount,
+			Comment:            parsed.desc,
+			CryptoHash:         &parsed.hash,
+			CryptoTonLT:        &tx.LT,
+			CryptoCounterparty: &parsed.merchant,
+			CryptoOpCode:       parsed.opCode,
+			CryptoMsgHash:      parsed.msgHash,
+			CryptoPrevHash:     &parsed.prevHash,
+			CryptoPrevLT:       &tx.PrevTxLT,
+			CryptoEntry:        EntryValue,
+			Kind:               kind,
+			Details:            details,
+			Internal:           parsed.internal(isInternal),
+			EffectiveAt:        parsed.effectiveAt,
+			AssetID:            assetID,
 		}
 		out = append(out, withoutFee)
 
-		if parsed.fee.Neg().IsZero() {
-			continue
-		}
+		if parsed.jetton != nil && parsed.jetton.amount.Sign() != 0 {
+			asset, err := resolveJetton(parsed.jetton.wallet)
+			if err != nil {
+				return nil, fmt.Errorf("resolve jetton: %w", err)
+			}
 
-		fee := Transaction{
-			AccountID:   accountID,
-			Merchant:    parsed.merchant,
-			Amount:      parsed.fee.Neg(),
-			Comment:     parsed.desc,
-			CryptoHash:  &parsed.hash,
-			CryptoTonLT: &tx.LT,
-			EffectiveAt: parsed.effectiveAt,
-			AssetID:     assetID,
+			if asset != nil {
+				counterparty := parsed.jetton.counterparty.String()
+				out = append(out, Transaction{
+					AccountID:          accountID,
+					Merchant:           counterparty,
+					Amount:             asset.amount(parsed.jetton.amount),
+					Comment:            parsed.jetton.comment,
+					CryptoHash:         &parsed.hash,
+					CryptoTonLT:        &tx.LT,
+					CryptoCounterparty: &counterparty,
+					CryptoOpCode:       parsed.opCode,
+					CryptoMsgHash:      parsed.jetton.msgHash(asset),
+					CryptoJetton:       &asset.master,
+					CryptoEntry:        EntryJetton,
+					Kind:               kind,
+					Details:            details,
+					Internal:           isInternal(parsed.jetton.counterparty),
+					EffectiveAt:        parsed.effectiveAt,
+					AssetID:            asset.assetID,
+				})
+			}
 		}
 
-		out = append(out, fee)
+		byEntry := parsed.fees.byEntry()
+		for _, entry := range feeEntries {
+			amount, ok := byEntry[entry]
+			if !ok {
+				continue
+			}
+
+			out = append(out, Transaction{
+				AccountID:   accountID,
+				CategoryID:  feeCategoryID,
+				Amount:      amount.Neg(),
+				Comment:     feeComments[entry],
+				CryptoHash:  &parsed.hash,
+				CryptoTonLT: &tx.LT,
+				CryptoEntry: entry,
+				EffectiveAt: parsed.effectiveAt,
+				AssetID:     assetID,
+			})
+		}
 	}
 
 	return out, nil
 }
 
 type parseTxResult struct {
+	tx                   *tlb.Transaction
 	merchant, desc, hash string
-	amount, fee          decimal.Decimal
+	prevHash             string
+	counterparty         *address.Address
+	msgHash              *string          // hash of the only message of the transaction, nil if it has none or several
+	inMsgHash            *string          // hash of the inbound internal message, nil if there is none
+	body                 *cell.Cell       // body of the message counterparty comes from
+	sender               *address.Address // sender of the message body comes from, the account itself for outgoing ones
+	amount               decimal.Decimal
+	fees                 fees
+	opCode               *uint32
+	jetton               *jettonTransfer
+	nfts                 []nftTransfer
+	swaps                []swapLeg
+	messages             []txMessage
 	effectiveAt          time.Time
 }
 
-func parseTx(tx *tlb.Transaction) (*parseTxResult, error) {
-	result := &parseTxResult{}
-	result.effectiveAt = time.Unix(int64(tx.Now), 0)
+// parseTx parses transaction loaded from the root cell, the cell is used to hash messages as they are on chain.
+func parseTx(tx *tlb.Transaction, root *cell.Cell) (*parseTxResult, error) {
+	result := &parseTxResult{tx: tx}
+	result.effectiveAt = time.Unix(int64(tx.Now), 0).UTC()
 	result.hash = txHashToString(tx.Hash)
+	result.prevHash = txHashToString(tx.PrevTxHash)
 
-	fee := tx.TotalFees.Coins.NanoTON()
+	forwardFee := new(big.Int)
 
-	if tx.IO.Out != nil {
-		listOut, err := tx.IO.Out.ToSlice()
-		if err != nil {
-			return nil, fmt.Errorf("parse out messages: %w", err)
-		}
+	if tx.IO.Out != nil && tx.IO.Out.List != nil {
+		for i, kv := range tx.IO.Out.List.All() {
+			msgCell, err := kv.Value.BeginParse().LoadRefCell()
+			if err != nil {
+				return nil, fmt.Errorf("load out message %d: %w", i, err)
+			}
+
+			var m tlb.Message
+			if err = m.LoadFromCell(msgCell.BeginParse()); err != nil {
+				return nil, fmt.Errorf("parse out message %d: %w", i, err)
+			}
 
-		for _, m := range listOut {
 			if m.MsgType == tlb.MsgTypeInternal {
 				msg := m.AsInternal()
 
@@ -158,12 +364,40 @@ func parseTx(tx *tlb.Transaction) (*parseTxResult, error) {
 					return nil, fmt.Errorf("parse out amount: %w", err)
 				}
 
-				fee.Add(fee, msg.IHRFee.NanoTON())
-				fee.Add(fee, msg.FwdFee.NanoTON())
+				forwardFee.Add(forwardFee, msg.IHRFee.Nano())
+				forwardFee.Add(forwardFee, msg.FwdFee.Nano())
 
 				result.amount = result.amount.Add(amount.Neg())
+				result.messages = append(result.messages, txMessage{
+					account:      msg.SrcAddr,
+					counterparty: msg.DstAddr,
+					amount:       amount.Neg(),
+					hash:         *msgHash(msgCell),
+				})
 				result.desc = msg.Comment()
 				result.merchant = msg.DestAddr().String()
+				result.counterparty = msg.DestAddr()
+				result.body = msg.Body
+				result.sender = msg.SrcAddr
+				result.opCode = opCode(msg.Body)
+
+				if result.opCode != nil && *result.opCode == opJettonTransfer {
+					if jt, err := parseJettonTransfer(msg); err == nil { // malformed body is just not a jetton transfer
+						result.jetton = jt
+					}
+				}
+
+				if result.opCode != nil && *result.opCode == opNFTTransfer {
+					if nt, err := parseNFTTransfer(msg); err == nil { // malformed body is just not an nft transfer
+						result.nfts = append(result.nfts, *nt)
+					}
+				}
+
+				if result.opCode != nil {
+					if leg := parseSwapRequest(msg, *result.opCode); leg != nil {
+						result.swaps = append(result.swaps, *leg)
+					}
+				}
 			}
 		}
 	}
@@ -176,17 +410,161 @@ func parseTx(tx *tlb.Transaction) (*parseTxResult, error) {
 			return nil, fmt.Errorf("parse int amount: %w", err)
 		}
 
-		result.amount = amount
+		msgCell, err := inMsgCell(root)
+		if err != nil {
+			return nil, fmt.Errorf("load in message: %w", err)
+		}
+		result.inMsgHash = msgHash(msgCell)
+
+		result.amount = result.amount.Add(amount) // value sent out in the same transaction stays subtracted
+		result.messages = append(result.messages, txMessage{
+			account:      msg.DstAddr,
+			counterparty: msg.SrcAddr,
+			amount:       amount,
+			hash:         *result.inMsgHash,
+		})
 		result.merchant = msg.SrcAddr.String()
+		result.counterparty = msg.SrcAddr
 		result.desc = msg.Comment()
+		result.body = msg.Body
+		result.sender = msg.SrcAddr
+		result.opCode = opCode(msg.Body)
+
+		if result.opCode != nil && *result.opCode == opJettonTransferNotification {
+			if jt, err := parseJettonNotification(msg); err == nil { // malformed body is just not a jetton transfer
+				result.jetton = jt
+			}
+		}
+
+		if result.opCode != nil && *result.opCode == opNFTOwnershipAssigned {
+			if nt, err := parseNFTOwnershipAssigned(msg); err == nil { // malformed body is just not an nft transfer
+				result.nfts = append(result.nfts, *nt)
+			}
+		}
+
+		if msg.Bounced && result.opCode != nil && *result.opCode == opBounced {
+			if nt := parseNFTBounce(msg); nt != nil {
+				result.nfts = append(result.nfts, *nt)
+			}
+			if jt := parseJettonBounce(msg); jt != nil {
+				result.jetton = jt
+			}
+		}
+
+		if leg := parseSwapPayout(msg, result.opCode); leg != nil {
+			result.swaps = append(result.swaps, *leg)
+		}
 	}
 
-	decimalFee, err := decimal.NewFromString(tlb.FromNanoTON(fee).TON())
-	if err != nil {
-		return nil, fmt.Errorf("parse fee: %w", err)
+	if len(result.messages) == 1 { // rows of several messages can't be paired with the row of any single counterparty
+		result.msgHash = &result.messages[0].hash
 	}
 
-	result.fee = decimalFee
+	result.fees = parseFees(tx, forwardFee)
 
 	return result, nil
 }
+
+// parseTxs parses transactions once for all rows, postings and records derived from them.
+func parseTxs(fetched []*fetchedTx) ([]*parseTxResult, error) {
+	out := make([]*parseTxResult, len(fetched))
+	for i, f := range fetched {
+		parsed, err := parseTx(f.tx, f.root)
+		if err != nil {
+			return nil, fmt.Errorf("parse transaction %s: %w", txHashToString(f.tx.Hash), err)
+		}
+		out[i] = parsed
+	}
+	return out, nil
+}
+
+// msgHash returns hash of the message cell, sender's and receiver's transactions keep the same cell.
+func msgHash(msgCell *cell.Cell) *string {
+	hash := txHashToString(msgCell.Hash())
+	return &hash
+}
+
+// inMsgCell returns cell of the inbound message of the transaction, nil if it has none.
+// Messages are referenced by the first ref of transaction, inbound one is maybe ref ahead of outbound dictionary.
+func inMsgCell(root *cell.Cell) (*cell.Cell, error) {
+	io, err := root.PeekRef(0)
+	if err != nil {
+		return nil, fmt.Errorf("load messages ref: %w", err)
+	}
+
+	slice := io.BeginParse()
+	ok, err := slice.LoadBoolBit()
+	if err != nil || !ok {
+		return nil, err
+	}
+	return slice.LoadRefCell()
+}
+
+// internal tells whether every message moving value is exchanged with another tracked account, transactions
+// also moving value to external parties are not internal. Messages without value to external parties don't count.
+func (r *parseTxResult) internal(isInternal func(counterparty *address.Address) bool) bool {
+	internal := false
+	for _, m := range r.messages {
+		if !isInternal(m.counterparty) {
+			if !m.amount.IsZero() {
+				return false
+			}
+			continue
+		}
+		internal = true
+	}
+	return internal
+}
+
+// isTrackedCounterparty tells whether the address is another tracked account than the given one.
+func isTrackedCounterparty(tracked map[string]*Account, accountID int, addr *address.Address) bool {
+	a, ok := tracked[rawAddr(addr)]
+	return ok && a.ID != accountID
+}
+
+// internalMsgHashes returns distinct hashes of messages exchanged with other tracked accounts, each one on its own
+// even if its transaction also moves value elsewhere, and hashes of internal jetton transfers.
+func internalMsgHashes(parsed []*parseTxResult, txs []Transaction, tracked map[string]*Account, accountID int) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(hash string) {
+		if !seen[hash] {
+			seen[hash] = true
+			out = append(out, hash)
+		}
+	}
+
+	for _, p := range parsed {
+		for _, m := range p.messages {
+			if isTrackedCounterparty(tracked, accountID, m.counterparty) {
+				add(m.hash)
+			}
+		}
+	}
+	for _, tx := range txs {
+		if tx.CryptoEntry == EntryJetton && tx.Internal && tx.CryptoMsgHash != nil {
+			add(*tx.CryptoMsgHash)
+		}
+	}
+	return out
+}
+
+// opCode returns first 32 bits of the message body or nil if body is shorter.
+func opCode(body *cell.Cell) *uint32 {
+	if body == nil {
+		return nil
+	}
+
+	slice := body.BeginParse()
+	if slice.BitsLeft() < 32 {
+		return nil
+	}
+
+	op, err := slice.LoadUInt(32)
+	if err != nil {
+		return nil
+	}
+
+	op32 := uint32(op)
+	return &op32
+}
@@ -0,0 +1,36 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+)
+
+func TestCastTransactionsNetZero(t *testing.T) {
+	account := address.MustParseAddr("EQCD39VS5jcptHL8vMjEXrzGaRcCVYto7HUn4bpAOg8xqB2N")
+	other := address.MustParseAddr("EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+
+	parsed := testTx{
+		account:     account,
+		in:          &tlb.InternalMessage{SrcAddr: other, DstAddr: account, Amount: tlb.MustFromTON("1")},
+		out:         []*tlb.InternalMessage{{SrcAddr: account, DstAddr: other, Amount: tlb.MustFromTON("1")}},
+		description: ordinary(),
+	}.parse(t)
+
+	rows, err := castTransactions([]*parseTxResult{parsed}, 1, 1, 0, nil, nil, defaultDecoders(), nil)
+	if err != nil {
+		t.Fatalf("cast transactions: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want a single value row", len(rows))
+	}
+
+	value := rows[0]
+	if value.CryptoEntry != EntryValue || !value.Amount.IsZero() {
+		t.Errorf("got %s row of %s, want value row of 0", value.CryptoEntry, value.Amount)
+	}
+	if value.CryptoPrevLT == nil || value.CryptoPrevHash == nil {
+		t.Error("value row doesn't carry the previous transaction")
+	}
+}